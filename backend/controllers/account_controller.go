@@ -0,0 +1,403 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxUnfreezeFailures  = 5
+	unfreezeLockDuration = 30 * time.Minute
+)
+
+type AccountController struct {
+	UserCollection            *mongo.Collection
+	TrustedDeviceCollection   *mongo.Collection
+	DeviceKeyCollection       *mongo.Collection
+	DeviceChallengeCollection *mongo.Collection
+	MagicLinkCollection       *mongo.Collection
+	LoginRequestCollection    *mongo.Collection
+	CodeController            *CodeController
+}
+
+func validFreezeReason(reason string) bool {
+	for _, r := range models.FreezeReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// frozenResponse is the body every endpoint returns when it refuses a frozen account
+var frozenResponse = gin.H{"error": "Account is frozen", "frozen": true}
+
+// FreezeAccount lets a signed-in user freeze their own account
+func (ac *AccountController) FreezeAccount(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason"`
+		Note   string `json:"note"`
+		Pin    string `json:"pin"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if !validFreezeReason(input.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freeze reason", "reasons": models.FreezeReasons})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ac.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Pin != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Pin), []byte(input.Pin)); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid PIN"})
+			return
+		}
+	}
+
+	freeze := models.AccountFreeze{
+		Reason:   input.Reason,
+		Note:     input.Note,
+		FrozenAt: time.Now(),
+		FrozenBy: models.FrozenBySelf,
+	}
+
+	_, err = ac.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"status": models.AccountStatusFrozen, "freeze": freeze}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to freeze account"})
+		return
+	}
+
+	c.SetCookie("token", "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Account frozen", "freeze": freeze})
+}
+
+// findAccount resolves an EID or email for the unauthenticated unfreeze flow
+func (ac *AccountController) findAccount(ctx context.Context, identifier string) (models.User, error) {
+	return findUserByIdentifier(ctx, ac.UserCollection, identifier)
+}
+
+// SendUnfreezeCode is the only code-sending endpoint open to frozen accounts
+func (ac *AccountController) SendUnfreezeCode(c *gin.Context) {
+	var input struct {
+		Identifier string `json:"identifier"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Identifier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifier required"})
+		return
+	}
+
+	if !requireCodePow(c, ac.CodeController.PowVerifier, powScopeUnfreezeCode) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	user, err := ac.findAccount(ctx, input.Identifier)
+
+	// with enumeration protection only a frozen account gets the code, in the
+	// background, and everyone gets the same answer after the same delay
+	if enumerationProtection() && (err == nil || errors.Is(err, services.ErrAccountNotFound)) {
+		if err == nil && user.IsFrozen() {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if _, _, err := ac.CodeController.sendPurposeCode(ctx, user, models.CodePurposeUnfreeze, "Your Unfreeze Code", "<h3>Your account unfreeze code is: <b>%s</b></h3>"); err != nil {
+					log.Printf("Failed to send unfreeze code: %v", err)
+				}
+			}()
+		} else {
+			go dummyCodeLookup(ac.CodeController.VerificationCodeCollection)
+		}
+		padResponse(start)
+		c.JSON(http.StatusOK, gin.H{"message": genericCodeMessage, "cooldown": int(getCooldown(0).Seconds())})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account not found"})
+		return
+	}
+
+	if !user.IsFrozen() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not frozen"})
+		return
+	}
+
+	attempts, cooldown, err := ac.CodeController.sendPurposeCode(ctx, user, models.CodePurposeUnfreeze,
+		"Your Unfreeze Code",
+		"<h3>Your account unfreeze code is: <b>%s</b></h3>",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts": attempts,
+		"cooldown": int(cooldown.Seconds()),
+	})
+}
+
+// UnfreezeAccount needs the password, the code from SendUnfreezeCode and the
+// TOTP code if set up. Too many wrong answers lock unfreezing for a while; the
+// lock only shows once the password is right, so it can't reveal the account.
+func (ac *AccountController) UnfreezeAccount(c *gin.Context) {
+	var input struct {
+		Identifier string `json:"identifier"`
+		Password   string `json:"password"`
+		Code       string `json:"code"`
+		TOTPCode   string `json:"totpCode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Identifier == "" || input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifier and password are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := ac.findAccount(ctx, input.Identifier)
+	if err != nil {
+		if enumerationProtection() {
+			burnPasswordCheck(input.Password)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		ac.recordUnfreezeFailure(ctx, user)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if !user.IsFrozen() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not frozen"})
+		return
+	}
+
+	if user.Freeze != nil && time.Now().Before(user.Freeze.LockedUntil) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later", "availableAt": user.Freeze.LockedUntil})
+		return
+	}
+
+	if err := ac.CodeController.verifyStepUpFor(ctx, user, models.CodePurposeUnfreeze, input.Code, input.TOTPCode); err != nil {
+		if !errors.Is(err, errStepUpCodeRequired) && !errors.Is(err, errStepUpTOTPRequired) {
+			ac.recordUnfreezeFailure(ctx, user)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = ac.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$unset": bson.M{"status": "", "freeze": ""}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfreeze account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unfrozen"})
+}
+
+// recordUnfreezeFailure counts a wrong answer against a frozen account and
+// locks unfreezing for unfreezeLockDuration after maxUnfreezeFailures of them
+func (ac *AccountController) recordUnfreezeFailure(ctx context.Context, user models.User) {
+	if !user.IsFrozen() {
+		return
+	}
+
+	var updated models.User
+	err := ac.UserCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID, "status": models.AccountStatusFrozen},
+		bson.M{"$inc": bson.M{"freeze.unfreezeFailures": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == nil && updated.Freeze != nil && updated.Freeze.UnfreezeFailures >= maxUnfreezeFailures {
+		_, _ = ac.UserCollection.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "status": models.AccountStatusFrozen},
+			bson.M{"$set": bson.M{"freeze.lockedUntil": time.Now().Add(unfreezeLockDuration)}, "$unset": bson.M{"freeze.unfreezeFailures": ""}},
+		)
+	}
+}
+
+// FreezeReasons lists the accepted reason codes
+func (ac *AccountController) FreezeReasons(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"reasons": models.FreezeReasons})
+}
+
+const emergencyFreezePage = `<!DOCTYPE html>
+<html><head><meta name="viewport" content="width=device-width, initial-scale=1"><title>Freeze account</title></head>
+<body style="font-family:sans-serif;max-width:480px;margin:40px auto;padding:0 16px">
+<h2>Freeze your account?</h2>
+<p>This signs out every device and blocks all sign-ins until you unfreeze the account from the app.</p>
+<form method="POST" action="/account/emergency-freeze">
+<input type="hidden" name="token" value="%s">
+<button type="submit" style="padding:12px 24px;font-size:16px">Freeze my account</button>
+</form>
+</body></html>`
+
+// EmergencyFreezePage is where the email link lands. Freezing happens on the
+// button's POST so link scanners that prefetch URLs can't freeze accounts.
+func (ac *AccountController) EmergencyFreezePage(c *gin.Context) {
+	token := c.Query("token")
+	if _, err := services.VerifyToken(killSwitchPurpose, token); err != nil {
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte("<p>This link is invalid or has expired.</p>"))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(fmt.Sprintf(emergencyFreezePage, html.EscapeString(token))))
+}
+
+// EmergencyFreeze freezes the account behind a kill-switch token, revokes every
+// session and every other way back in (trusted devices, device keys, magic
+// links, QR sign-ins) and queues a recovery email. Repeating it is harmless.
+func (ac *AccountController) EmergencyFreeze(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		var input struct {
+			Token string `json:"token"`
+		}
+		_ = c.ShouldBindJSON(&input)
+		token = input.Token
+	}
+
+	userHex, err := services.VerifyToken(killSwitchPurpose, token)
+	if err != nil {
+		ac.emergencyFreezeResponse(c, http.StatusBadRequest, "This link is invalid or has expired.")
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(userHex)
+	if err != nil {
+		ac.emergencyFreezeResponse(c, http.StatusBadRequest, "This link is invalid or has expired.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	freeze := models.AccountFreeze{
+		Reason:   models.FreezeReasonSecurity,
+		FrozenAt: now,
+		FrozenBy: models.FrozenByKillSwitch,
+	}
+
+	// Only the first click changes the status; later clicks just revoke sessions again
+	var user models.User
+	err = ac.UserCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID, "status": bson.M{"$ne": models.AccountStatusFrozen}},
+		bson.M{
+			"$set":   bson.M{"status": models.AccountStatusFrozen, "freeze": freeze, "sessionsRevokedAt": now},
+			"$unset": bson.M{"deletion": ""}, // a deletion someone else requested is cancelled too
+		},
+	).Decode(&user)
+	transitioned := err == nil
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = ac.UserCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": userID},
+			bson.M{"$set": bson.M{"sessionsRevokedAt": now}},
+		).Decode(&user)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ac.emergencyFreezeResponse(c, http.StatusNotFound, "This account no longer exists.")
+		return
+	} else if err != nil {
+		ac.emergencyFreezeResponse(c, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	ac.revokeSignInCredentials(ctx, user.ID, now)
+
+	if transitioned {
+		services.QueueEmail(
+			user.Email,
+			"Your account has been frozen",
+			"<h3>Your account was frozen from the link in one of our security emails.</h3>"+
+				"<p>All devices have been signed out. To recover your account, open the app, choose <b>Unfreeze account</b> "+
+				"and verify with your password and the code we email you. We recommend resetting your password afterwards.</p>",
+		)
+	}
+
+	c.SetCookie("token", "", -1, "/", "", false, true)
+	ac.emergencyFreezeResponse(c, http.StatusOK, "Your account is frozen and every device has been signed out. Check your email for recovery steps.")
+}
+
+// revokeSignInCredentials removes everything that could sign the user in
+// without their password: trusted devices, device keys and their open
+// challenges, unused magic links and QR sign-ins they've scanned or approved.
+func (ac *AccountController) revokeSignInCredentials(ctx context.Context, userID primitive.ObjectID, now time.Time) {
+	if _, err := ac.TrustedDeviceCollection.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		log.Printf("Warning: Failed to revoke trusted devices for %s: %v", userID.Hex(), err)
+	}
+	if _, err := ac.DeviceKeyCollection.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		log.Printf("Warning: Failed to revoke device keys for %s: %v", userID.Hex(), err)
+	}
+	if _, err := ac.DeviceChallengeCollection.DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+		log.Printf("Warning: Failed to revoke device key challenges for %s: %v", userID.Hex(), err)
+	}
+	if _, err := ac.MagicLinkCollection.UpdateMany(ctx,
+		bson.M{"userId": userID, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	); err != nil {
+		log.Printf("Warning: Failed to invalidate magic links for %s: %v", userID.Hex(), err)
+	}
+	if _, err := ac.LoginRequestCollection.UpdateMany(ctx,
+		bson.M{"$or": []bson.M{
+			{"status": models.LoginRequestPending, "viewerId": userID},
+			{"status": models.LoginRequestApproved, "approvedBy": userID},
+		}},
+		bson.M{"$set": bson.M{"status": models.LoginRequestDenied}},
+	); err != nil {
+		log.Printf("Warning: Failed to deny QR sign-ins for %s: %v", userID.Hex(), err)
+	}
+}
+
+// emergencyFreezeResponse answers the browser form with HTML and API clients with JSON
+func (ac *AccountController) emergencyFreezeResponse(c *gin.Context, status int, message string) {
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		if status == http.StatusOK {
+			c.JSON(status, gin.H{"message": message, "frozen": true})
+		} else {
+			c.JSON(status, gin.H{"error": message})
+		}
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", []byte("<p>"+html.EscapeString(message)+"</p>"))
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// deletionGracePeriod reads ACCOUNT_DELETION_GRACE_DAYS, defaulting to 30 days
+func deletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// SendDeletionCode emails the step-up code needed to request deletion
+func (ac *AccountController) SendDeletionCode(c *gin.Context) {
+	if !requireCodePow(c, ac.CodeController.PowVerifier, powScopeDeletionCode) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ac.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	attempts, cooldown, err := ac.CodeController.sendPurposeCode(ctx, user, models.CodePurposeStepUp,
+		"Your Account Deletion Code",
+		"<h3>Your account deletion code is: <b>%s</b></h3><p>If you didn't ask to delete your account, change your password now.</p>",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts": attempts,
+		"cooldown": int(cooldown.Seconds()),
+	})
+}
+
+// RequestDeletion schedules the signed-in account for deletion after the grace
+// period. It needs the password plus step-up verification and signs out every device.
+func (ac *AccountController) RequestDeletion(c *gin.Context) {
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+		TOTPCode string `json:"totpCode"`
+		Reason   string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ac.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if err := ac.CodeController.verifyStepUp(ctx, user, input.Code, input.TOTPCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	deletion := models.AccountDeletion{
+		Reason:      input.Reason,
+		RequestedAt: now,
+		PurgeAt:     now.Add(deletionGracePeriod()),
+	}
+
+	_, err = ac.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{
+			"status":            models.AccountStatusPendingDeletion,
+			"deletion":          deletion,
+			"sessionsRevokedAt": now,
+		}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule deletion"})
+		return
+	}
+
+	if _, err := ac.TrustedDeviceCollection.DeleteMany(ctx, bson.M{"userId": user.ID}); err != nil {
+		log.Printf("Warning: Failed to revoke trusted devices for %s: %v", user.Email, err)
+	}
+
+	go sendSecurityEmail(user, "Your account is scheduled for deletion", fmt.Sprintf(
+		"<h3>Your account will be permanently deleted on %s.</h3><p>Changed your mind? Just sign in before then and the deletion is cancelled.</p>",
+		deletion.PurgeAt.Format("January 2, 2006"),
+	))
+
+	c.SetCookie("token", "", -1, "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Account scheduled for deletion", "deletion": deletion})
+}
+
+// cancelPendingDeletion restores an account that signs in during its grace
+// period. Every sign-in path calls it right before issuing a session, and must
+// not sign the user in if it fails.
+func cancelPendingDeletion(ctx context.Context, users *mongo.Collection, user *models.User) (bool, error) {
+	if !user.IsPendingDeletion() {
+		return false, nil
+	}
+
+	result, err := users.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "status": models.AccountStatusPendingDeletion},
+		bson.M{"$unset": bson.M{"status": "", "deletion": ""}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount == 0 {
+		return false, nil
+	}
+
+	user.Status = models.AccountStatusActive
+	user.Deletion = nil
+
+	go sendSecurityEmail(*user, "Account deletion cancelled",
+		"<h3>You signed in, so your account will no longer be deleted.</h3>")
+	return true, nil
+}
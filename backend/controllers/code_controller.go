@@ -19,8 +19,12 @@ import (
 )
 
 type CodeController struct {
-	EmailCodeCollection *mongo.Collection
-	UserCollection      *mongo.Collection
+	EmailCodeCollection        *mongo.Collection
+	VerificationCodeCollection *mongo.Collection
+	UserCollection             *mongo.Collection
+	SMSCodeCollection          *mongo.Collection
+	PowVerifier                *services.PowVerifier
+	EmailValidator             *services.EmailValidator
 }
 
 // func CleanupExpiredCodes(collection *mongo.Collection) {
@@ -88,10 +92,18 @@ func (cc *CodeController) GetCode(c *gin.Context) {
 		return
 	}
 
+	if !requireCodePow(c, cc.PowVerifier, powScopeGetCode) {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	email := strings.TrimSpace(strings.ToLower(req.Email))
+	email, err := cc.EmailValidator.Validate(ctx, req.Email)
+	if err != nil {
+		respondEmailError(c, err)
+		return
+	}
 	now := time.Now()
 
 	var user models.User
@@ -133,7 +145,6 @@ func (cc *CodeController) GetCode(c *gin.Context) {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"code":     code,
 			"attempts": attempts,
 			"cooldown": int(cooldown.Seconds()),
 		})
@@ -156,7 +167,6 @@ func (cc *CodeController) GetCode(c *gin.Context) {
 			}
 
 			c.JSON(http.StatusOK, gin.H{
-				"code":     existing.Code,
 				"attempts": attempts,
 				"cooldown": int(remaining.Seconds()),
 			})
@@ -191,7 +201,7 @@ func (cc *CodeController) GetCode(c *gin.Context) {
 	// New email → first attempt
 	newCode := utils.GenerateCode(6)
 	attempts = 1
-	_, err := cc.EmailCodeCollection.UpdateOne(
+	_, err = cc.EmailCodeCollection.UpdateOne(
 		ctx,
 		bson.M{"email": email},
 		bson.M{
@@ -222,12 +232,18 @@ func (cc *CodeController) VerifyCode(c *gin.Context) {
 		return
 	}
 
+	email, err := services.NormalizeEmail(req.Email)
+	if err != nil {
+		respondEmailError(c, err)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var existing models.EmailCode
-	err := cc.EmailCodeCollection.FindOne(ctx, bson.M{
-		"email":    req.Email,
+	err = cc.EmailCodeCollection.FindOne(ctx, bson.M{
+		"email":    email,
 		"isActive": true,
 	}).Decode(&existing)
 
@@ -326,137 +342,42 @@ func (cc *CodeController) GetCodeSignIn(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	var user models.User
-	var email string
-
-	// Resolve identifier (email or EID)
-	if strings.Contains(input.Identifier, "@") {
-		email = strings.TrimSpace(strings.ToLower(input.Identifier))
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "email not registered"})
-			return
-		}
-	} else {
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"eid": input.Identifier}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid EID"})
-			return
-		}
-		email = user.Email
+	if !requireCodePow(c, cc.PowVerifier, powScopeGetCodeSignIn) {
+		return
 	}
 
-	now := time.Now()
-	var existing models.EmailCode
-	attempts := 0
-
-	// Check for existing code record
-	findErr := cc.EmailCodeCollection.FindOne(ctx, bson.M{"email": email}).Decode(&existing)
-	if findErr != nil && !errors.Is(findErr, mongo.ErrNoDocuments) {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+	if enumerationProtection() {
+		cc.sendCodeUniformly(c, input.Identifier, models.CodePurposeSignIn, "Your Login Verification Code", "<h3>Your login code is: <b>%s</b></h3>")
 		return
 	}
 
-	// Case 1: existing email
-	if findErr == nil {
-		attempts = existing.SendCodeAttempts
-		remaining := remainingCooldown(existing.SentAt, attempts-1)
-
-		if remaining > 0 {
-			// Still in cooldown → send same code
-			if err := services.SendEmail(
-				email,
-				"Your Login Verification Code",
-				fmt.Sprintf("<h3>Your login code is: <b>%s</b></h3>", existing.Code),
-			); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
-				return
-			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"code":     existing.Code,
-				"attempts": attempts,
-				"cooldown": int(remaining.Seconds()),
-			})
-			return
-		}
-
-		// Cooldown finished → generate new code
-		attempts++ // count this request
-		newCode := utils.GenerateCode(6)
-
-		_, err := cc.EmailCodeCollection.UpdateOne(
-			ctx,
-			bson.M{"email": email},
-			bson.M{
-				"$set": bson.M{
-					"code":     newCode,
-					"sentAt":   now,
-					"isActive": true,
-				},
-				"$inc": bson.M{"sendCodeAttempts": 1},
-			},
-			options.Update().SetUpsert(true),
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-			return
-		}
-
-		if err := services.SendEmail(
-			email,
-			"Your Login Verification Code",
-			fmt.Sprintf("<h3>Your login code is: <b>%s</b></h3>", newCode),
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
-			return
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-		currentCooldown := getCooldown(attempts - 1)
-		c.JSON(http.StatusOK, gin.H{
-			"code":     newCode,
-			"attempts": attempts,
-			"cooldown": int(currentCooldown.Seconds()),
-		})
+	// Resolve identifier (email, EID, phone or @handle)
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, input.Identifier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": identifierError(err)})
 		return
 	}
 
-	// Case 2: new email → first attempt
-	newCode := utils.GenerateCode(6)
-	attempts = 1
-
-	_, err := cc.EmailCodeCollection.UpdateOne(
-		ctx,
-		bson.M{"email": email},
-		bson.M{
-			"$set": bson.M{
-				"code":     newCode,
-				"sentAt":   now,
-				"isActive": true,
-			},
-			"$inc": bson.M{"sendCodeAttempts": 1},
-		},
-		options.Update().SetUpsert(true),
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
 		return
 	}
 
-	if err := services.SendEmail(
-		email,
+	attempts, cooldown, err := cc.sendPurposeCode(ctx, user, models.CodePurposeSignIn,
 		"Your Login Verification Code",
-		fmt.Sprintf("<h3>Your login code is: <b>%s</b></h3>", newCode),
-	); err != nil {
+		"<h3>Your login code is: <b>%s</b></h3>",
+	)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"code":     newCode,
 		"attempts": attempts,
-		"cooldown": int(getCooldown(0).Seconds()), // first attempt
+		"cooldown": int(cooldown.Seconds()),
 	})
 }
 
@@ -538,32 +459,20 @@ func (cc *CodeController) VerifyCodeSignIn(c *gin.Context) {
 	}
 
 	ctx := context.TODO()
-	var user models.User
-	var email string
-
-	if strings.Contains(req.Identifier, "@") {
-		email = strings.TrimSpace(strings.ToLower(req.Identifier))
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email not registered", "valid": false})
-			return
-		}
-	} else {
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"eid": req.Identifier}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid EID", "valid": false})
-			return
-		}
-		email = user.Email
+	// Resolve identifier (email, EID, phone or @handle)
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, req.Identifier)
+	if hideUnknownAccount(err) {
+		dummyCodeLookup(cc.VerificationCodeCollection)
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidCodeMessage, "valid": false})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": identifierError(err), "valid": false})
+		return
 	}
 
-	var codeDoc models.EmailCode
-	err := cc.EmailCodeCollection.FindOne(ctx, bson.M{
-		"email":    email,
-		"code":     req.Code,
-		"isActive": true,
-	}).Decode(&codeDoc)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code", "valid": false})
+	// only checks the code for the UI; sign-in uses it up. A wrong guess still counts.
+	if err := cc.verifyPurposeCode(ctx, user, models.CodePurposeSignIn, req.Code, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidCodeMessage, "valid": false})
 		return
 	}
 
@@ -645,137 +554,41 @@ func (cc *CodeController) SendResetCode(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	var user models.User
-	var email string
-
-	// Resolve identifier (email or EID)
-	if strings.Contains(req.Identifier, "@") {
-		email = strings.TrimSpace(strings.ToLower(req.Identifier))
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "email not registered"})
-			return
-		}
-	} else {
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"eid": req.Identifier}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid EID"})
-			return
-		}
-		email = user.Email
-	}
-
-	now := time.Now()
-	var existing models.EmailCode
-	attempts := 0
-
-	// Check existing record
-	findErr := cc.EmailCodeCollection.FindOne(ctx, bson.M{"email": email}).Decode(&existing)
-	if findErr != nil && !errors.Is(findErr, mongo.ErrNoDocuments) {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+	if !requireCodePow(c, cc.PowVerifier, powScopeSendResetCode) {
 		return
 	}
 
-	// Case 1: existing email
-	if findErr == nil {
-		attempts = existing.SendCodeAttempts
-		remaining := remainingCooldown(existing.SentAt, attempts-1) // cooldown based on previous attempt
-
-		if remaining > 0 {
-			// Still in cooldown → resend same code
-			if err := services.SendEmail(
-				email,
-				"Password Reset Code",
-				fmt.Sprintf("<h3>Your password reset code is: <b>%s</b></h3>", existing.Code),
-			); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
-				return
-			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"code":     existing.Code,
-				"attempts": attempts,
-				"cooldown": int(remaining.Seconds()),
-			})
-			return
-		}
-
-		// Cooldown finished → generate new code
-		attempts++ // count this request
-		newCode := utils.GenerateCode(6)
-
-		_, err := cc.EmailCodeCollection.UpdateOne(
-			ctx,
-			bson.M{"email": email},
-			bson.M{
-				"$set": bson.M{
-					"code":     newCode,
-					"sentAt":   now,
-					"isActive": true,
-				},
-				"$inc": bson.M{"sendCodeAttempts": 1},
-			},
-			options.Update().SetUpsert(true),
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-			return
-		}
-
-		if err := services.SendEmail(
-			email,
-			"Password Reset Code",
-			fmt.Sprintf("<h3>Your password reset code is: <b>%s</b></h3>", newCode),
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
-			return
-		}
-
-		currentCooldown := getCooldown(attempts - 1)
-		c.JSON(http.StatusOK, gin.H{
-			"code":     newCode,
-			"attempts": attempts,
-			"cooldown": int(currentCooldown.Seconds()),
-		})
+	if enumerationProtection() {
+		cc.sendCodeUniformly(c, req.Identifier, models.CodePurposePasswordReset, "Password Reset Code", "<h3>Your password reset code is: <b>%s</b></h3>")
 		return
 	}
 
-	// Case 2: new email → first attempt
-	newCode := utils.GenerateCode(6)
-	attempts = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	_, err := cc.EmailCodeCollection.UpdateOne(
-		ctx,
-		bson.M{"email": email},
-		bson.M{
-			"$set": bson.M{
-				"code":     newCode,
-				"sentAt":   now,
-				"isActive": true,
-			},
-			"$inc": bson.M{"sendCodeAttempts": 1},
-		},
-		options.Update().SetUpsert(true),
-	)
+	// Resolve identifier (email, EID, phone or @handle)
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, req.Identifier)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": identifierError(err)})
+		return
+	}
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
 		return
 	}
 
-	if err := services.SendEmail(
-		email,
+	attempts, cooldown, err := cc.sendPurposeCode(ctx, user, models.CodePurposePasswordReset,
 		"Password Reset Code",
-		fmt.Sprintf("<h3>Your password reset code is: <b>%s</b></h3>", newCode),
-	); err != nil {
+		"<h3>Your password reset code is: <b>%s</b></h3>",
+	)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"code":     newCode,
 		"attempts": attempts,
-		"cooldown": int(getCooldown(0).Seconds()), // first attempt
+		"cooldown": int(cooldown.Seconds()),
 	})
 }
 
@@ -856,44 +669,23 @@ func (cc *CodeController) VerifyResetCode(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	var user models.User
-	var email string
-
-	// Resolve identifier to email
-	if strings.Contains(req.Identifier, "@") {
-		email = strings.TrimSpace(strings.ToLower(req.Identifier))
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email not registered"})
-			return
-		}
-	} else {
-		if err := cc.UserCollection.FindOne(ctx, bson.M{"eid": req.Identifier}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid EID"})
-			return
-		}
-		email = user.Email
+	// Resolve identifier (email, EID, phone or @handle)
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, req.Identifier)
+	if hideUnknownAccount(err) {
+		dummyCodeLookup(cc.VerificationCodeCollection)
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidCodeMessage})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": identifierError(err)})
+		return
 	}
 
-	// Lookup code using resolved email
-	var codeDoc models.EmailCode
-	err := cc.EmailCodeCollection.FindOne(ctx, bson.M{
-		"email":    email,
-		"code":     req.Code,
-		"isActive": true,
-	}).Decode(&codeDoc)
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
+	// ResetPassword uses the code up; this only checks it, though a wrong guess still counts
+	if err := cc.verifyPurposeCode(ctx, user, models.CodePurposePasswordReset, req.Code, false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidCodeMessage})
 		return
 	}
 
-	// 5-minute validity
-	// if time.Since(codeDoc.SentAt) > 15*time.Minute {
-	// 	// _, _ = cc.EmailCodeCollection.DeleteOne(ctx, bson.M{"_id": codeDoc.ID})
-	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Code expired"})
-	// 	return
-	// }
-
 	c.JSON(http.StatusOK, gin.H{"verified": true})
 }
 
@@ -1165,6 +957,10 @@ func (cc *CodeController) GetEIDCode(c *gin.Context) {
 		return
 	}
 
+	if !requireCodePow(c, cc.PowVerifier, powScopeSendEIDCode) {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -1172,12 +968,17 @@ func (cc *CodeController) GetEIDCode(c *gin.Context) {
 	now := time.Now()
 
 	// Check if user exists
-	var user bson.M
+	var user models.User
 	if err := cc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Email not registered"})
 		return
 	}
 
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
 	var existing models.EmailCode
 	attempts := 0
 
@@ -1212,7 +1013,6 @@ func (cc *CodeController) GetEIDCode(c *gin.Context) {
 			)
 
 			c.JSON(http.StatusOK, gin.H{
-				"code":     existing.Code,
 				"attempts": attempts + 1,
 				"cooldown": int(remaining.Seconds()),
 			})
@@ -1252,7 +1052,6 @@ func (cc *CodeController) GetEIDCode(c *gin.Context) {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"code":     newCode,
 			"attempts": attempts,
 			"cooldown": int(currentCooldown.Seconds()),
 		})
@@ -1292,7 +1091,6 @@ func (cc *CodeController) GetEIDCode(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"code":     newCode,
 		"attempts": attempts,
 		"cooldown": int(currentCooldown.Seconds()),
 	})
@@ -1346,17 +1144,42 @@ func (cc *CodeController) ForgotEID(c *gin.Context) {
 		return
 	}
 
+	if !requireCodePow(c, cc.PowVerifier, powScopeForgotEID) {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Find user by email
 	var user models.User
-	err := cc.UserCollection.FindOne(ctx, bson.M{"email": strings.ToLower(req.Email)}).Decode(&user)
+	err := cc.UserCollection.FindOne(ctx, bson.M{"email": strings.TrimSpace(strings.ToLower(req.Email))}).Decode(&user)
+
+	// with enumeration protection the EID is queued for real accounts only and
+	// the answer is the same either way
+	if enumerationProtection() {
+		start := time.Now()
+		if err == nil && !user.IsFrozen() {
+			services.QueueEmail(user.Email, "Your EID", fmt.Sprintf("<h3>Your EID is: <b>%s</b></h3>", user.EID))
+			_, _ = cc.EmailCodeCollection.DeleteMany(ctx, bson.M{"email": user.Email, "isActive": true})
+		} else {
+			dummyCodeLookup(cc.EmailCodeCollection)
+		}
+		padResponse(start)
+		c.JSON(http.StatusOK, gin.H{"message": genericEIDMessage})
+		return
+	}
+
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Email not registered"})
 		return
 	}
 
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
 	// Send EID via email
 	err = services.SendEmail(
 		user.Email,
@@ -1373,3 +1196,39 @@ func (cc *CodeController) ForgotEID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "EID sent successfully"})
 }
+
+// sendCodeUniformly is the enumeration-protected send: a real account gets the
+// code in the background, anyone else gets equivalent dummy work, and both get
+// the same answer after the same delay. Malformed identifiers still fail fast,
+// since that says nothing about any account.
+func (cc *CodeController) sendCodeUniformly(c *gin.Context, identifier, purpose, subject, format string) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, identifier)
+	switch {
+	case err == nil && !user.IsFrozen():
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if _, _, err := cc.sendPurposeCode(ctx, user, purpose, subject, format); err != nil {
+				log.Printf("Failed to send code: %v", err)
+			}
+		}()
+	case err == nil, errors.Is(err, services.ErrAccountNotFound):
+		go dummyCodeLookup(cc.VerificationCodeCollection)
+	case isIdentifierInputError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	padResponse(start)
+	c.JSON(http.StatusOK, gin.H{
+		"message":  genericCodeMessage,
+		"cooldown": int(getCooldown(0).Seconds()),
+	})
+}
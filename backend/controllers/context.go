@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// currentUser loads the user behind the email set by AuthMiddleware
+func currentUser(ctx context.Context, c *gin.Context, users *mongo.Collection) (models.User, error) {
+	var user models.User
+
+	email, ok := c.Get("email")
+	if !ok {
+		return user, mongo.ErrNoDocuments
+	}
+
+	err := users.FindOne(ctx, bson.M{"email": email.(string)}).Decode(&user)
+	return user, err
+}
+
+// currentProfileID is the profile the session is scoped to; ok is false for the default profile
+func currentProfileID(c *gin.Context) (primitive.ObjectID, bool) {
+	value, exists := c.Get("profile_id")
+	if !exists {
+		return primitive.NilObjectID, false
+	}
+	id, err := primitive.ObjectIDFromHex(value.(string))
+	return id, err == nil
+}
+
+// findUserByIdentifier resolves an email, EID, phone number or @handle
+func findUserByIdentifier(ctx context.Context, users *mongo.Collection, identifier string) (models.User, error) {
+	user, _, err := services.IdentifierResolver{Users: users}.Resolve(ctx, identifier)
+	return user, err
+}
+
+// identifierError is the message for a failed identifier lookup; input and
+// not-found errors are shown as they are, anything else is a database error
+func identifierError(err error) string {
+	if errors.Is(err, services.ErrAccountNotFound) || isIdentifierInputError(err) {
+		return err.Error()
+	}
+	return "Database error"
+}
+
+// isIdentifierInputError reports whether the identifier was malformed, which
+// is caught before any database lookup
+func isIdentifierInputError(err error) bool {
+	for _, inputErr := range []error{
+		services.ErrIdentifierRequired,
+		services.ErrInvalidEmail,
+		services.ErrInvalidPhone,
+		services.ErrInvalidHandle,
+		services.ErrEIDFormat,
+		services.ErrEIDCheck,
+	} {
+		if errors.Is(err, inputErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// respondEmailError tells the signup screen why an address was refused, with
+// an errorCode it can switch on
+func respondEmailError(c *gin.Context, err error) {
+	var emailErr *services.EmailError
+	if errors.As(err, &emailErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": emailErr.Message, "errorCode": emailErr.Code})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/services"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// patternString turns the dots the app sends (0-based) into the "1-5-9-8" form that gets hashed
+func patternString(dots []int) string {
+	dotStrings := make([]string, len(dots))
+	for i, dot := range dots {
+		dotStrings[i] = fmt.Sprintf("%d", dot+1)
+	}
+	return strings.Join(dotStrings, "-")
+}
+
+// ChangePassword needs the current password. Every other session is revoked
+// and this device gets a fresh token.
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+		ConfirmPassword string `json:"confirmPassword"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.CurrentPassword == "" || input.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currentPassword and newPassword are required"})
+		return
+	}
+
+	if input.NewPassword != input.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passwords do not match"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid current password"})
+		return
+	}
+
+	if input.NewPassword == input.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different"})
+		return
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password encryption failed"})
+		return
+	}
+
+	// revoke at the previous second so the token issued below (iat = now) stays valid
+	revokedAt := time.Now().Truncate(time.Second)
+	_, err = uc.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"password": string(hashed), "sessionsRevokedAt": revokedAt}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	opts := sessionOptions{}
+	if jkt, ok := c.Get("jkt"); ok {
+		opts.JKT = jkt.(string)
+	}
+	if exp, ok := c.Get("session_exp"); ok {
+		opts.ExpiresAt = exp.(time.Time)
+	}
+	if profileID, ok := c.Get("profile_id"); ok {
+		opts.ProfileID = profileID.(string)
+	}
+
+	tokenString, err := issueSession(c, user, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	go sendSecurityEmail(user,
+		"Your password was changed",
+		fmt.Sprintf("<h3>The password for your account was changed on %s.</h3><p>All other devices have been signed out.</p>", time.Now().UTC().Format(time.RFC1123)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully", "token": tokenString})
+}
+
+// ChangePin replaces an existing PIN; the current PIN is required
+func (uc *UserController) ChangePin(c *gin.Context) {
+	var input struct {
+		CurrentPin string `json:"currentPin"`
+		NewPin     string `json:"newPin"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := services.ValidateNewPin(input.NewPin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Pin == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No PIN registered"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Pin), []byte(input.CurrentPin)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid current PIN"})
+		return
+	}
+
+	hashedPin, err := bcrypt.GenerateFromPassword([]byte(input.NewPin), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
+		return
+	}
+
+	_, err = uc.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"pin": string(hashedPin)}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change PIN"})
+		return
+	}
+
+	go sendSecurityEmail(user, "Your PIN was changed",
+		"<h3>The PIN for your account was just changed.</h3><p>If you did this, no action is needed.</p>")
+
+	c.JSON(http.StatusOK, gin.H{"message": "PIN changed successfully"})
+}
+
+// ChangePattern replaces an existing unlock pattern; the current pattern is required
+func (uc *UserController) ChangePattern(c *gin.Context) {
+	var input struct {
+		CurrentPattern []int `json:"currentPattern"`
+		NewPattern     []int `json:"newPattern"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	if err := services.ValidateNewPattern(input.NewPattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.PatternHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pattern not registered"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PatternHash), []byte(patternString(input.CurrentPattern))); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current pattern does not match"})
+		return
+	}
+
+	hashedPattern, err := bcrypt.GenerateFromPassword([]byte(patternString(input.NewPattern)), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash pattern"})
+		return
+	}
+
+	_, err = uc.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"patternHash": string(hashedPattern)}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change pattern"})
+		return
+	}
+
+	go sendSecurityEmail(user, "Your unlock pattern was changed",
+		"<h3>The unlock pattern for your account was just changed.</h3><p>If you did this, no action is needed.</p>")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pattern changed successfully"})
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const dataExportPurpose = "data_export"
+
+type DataExportController struct {
+	UserCollection       *mongo.Collection
+	DataExportCollection *mongo.Collection
+	Database             *mongo.Database // the export reads from every collection holding user data
+}
+
+// SetupDataExportIndexes lets Mongo drop exports (and their archives) once the link expires
+func SetupDataExportIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.M{"userId": 1}},
+	})
+	if err != nil {
+		log.Println("Failed to create data export indexes:", err)
+	}
+}
+
+// dataExportTTL reads DATA_EXPORT_TTL_HOURS, defaulting to 48 hours
+func dataExportTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("DATA_EXPORT_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = 48
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// RequestDataExport starts building the signed-in user's export in the background.
+// The download link is emailed when it's ready.
+func (ec *DataExportController) RequestDataExport(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ec.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// One export at a time
+	err = ec.DataExportCollection.FindOne(ctx, bson.M{"userId": user.ID, "status": models.DataExportPending}).Err()
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export is already being prepared"})
+		return
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	now := time.Now()
+	export := models.DataExport{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Status:    models.DataExportPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(dataExportTTL()),
+	}
+	if _, err := ec.DataExportCollection.InsertOne(ctx, export); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+
+	go ec.runDataExport(export, user)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Export started, we'll email you a download link", "export": export})
+}
+
+// runDataExport builds the archive, stores it and emails the download link
+func (ec *DataExportController) runDataExport(export models.DataExport, user models.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	archive, err := services.BuildUserExport(ctx, ec.Database, user)
+	if err != nil {
+		log.Printf("Data export %s failed: %v", export.ID.Hex(), err)
+		_, _ = ec.DataExportCollection.UpdateOne(ctx,
+			bson.M{"_id": export.ID},
+			bson.M{"$set": bson.M{"status": models.DataExportFailed, "completedAt": time.Now()}},
+		)
+		return
+	}
+
+	_, err = ec.DataExportCollection.UpdateOne(ctx,
+		bson.M{"_id": export.ID},
+		bson.M{"$set": bson.M{
+			"status":      models.DataExportReady,
+			"archive":     archive,
+			"size":        len(archive),
+			"completedAt": time.Now(),
+		}},
+	)
+	if err != nil {
+		log.Printf("Failed to store data export %s: %v", export.ID.Hex(), err)
+		return
+	}
+
+	token := services.SignToken(dataExportPurpose, export.ID.Hex(), time.Until(export.ExpiresAt))
+	link := publicAPIURL() + "/account/export/download?token=" + url.QueryEscape(token)
+
+	sendSecurityEmail(user, "Your data export is ready", fmt.Sprintf(
+		`<h3>Your personal data export is ready.</h3><p><a href="%s">Download it here</a>. The link expires on %s.</p>`,
+		link, export.ExpiresAt.Format("January 2, 2006 15:04 MST"),
+	))
+}
+
+// GetDataExport reports the status of one of the signed-in user's exports
+func (ec *DataExportController) GetDataExport(c *gin.Context) {
+	exportID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ec.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var export models.DataExport
+	err = ec.DataExportCollection.FindOne(ctx,
+		bson.M{"_id": exportID, "userId": user.ID},
+		options.FindOne().SetProjection(bson.M{"archive": 0}),
+	).Decode(&export)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"export": export})
+}
+
+// DownloadDataExport serves the ZIP behind the emailed, time-limited link
+func (ec *DataExportController) DownloadDataExport(c *gin.Context) {
+	exportHex, err := services.VerifyToken(dataExportPurpose, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	exportID, err := primitive.ObjectIDFromHex(exportHex)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var export models.DataExport
+	err = ec.DataExportCollection.FindOne(ctx, bson.M{
+		"_id":       exportID,
+		"status":    models.DataExportReady,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&export)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found or expired"})
+		return
+	}
+
+	filename := fmt.Sprintf("data-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", export.Archive)
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const deviceTrustPurpose = "device_trust"
+
+type DeviceController struct {
+	UserCollection            *mongo.Collection
+	TrustedDeviceCollection   *mongo.Collection
+	DeviceKeyCollection       *mongo.Collection
+	DeviceChallengeCollection *mongo.Collection
+	SignInFlow                *SignInFlow
+}
+
+// SetupTrustedDeviceIndexes lets Mongo drop trusted devices once they expire
+func SetupTrustedDeviceIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.M{"userId": 1}},
+	})
+	if err != nil {
+		log.Println("Failed to create trusted device indexes:", err)
+	}
+}
+
+// deviceTrustTTL reads DEVICE_TRUST_TTL_DAYS, defaulting to 30 days
+func deviceTrustTTL() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("DEVICE_TRUST_TTL_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// IssueTrustToken remembers the device and returns the token the client must keep
+func (dc *DeviceController) IssueTrustToken(ctx context.Context, user models.User, name, ip string) (string, error) {
+	now := time.Now()
+	ttl := deviceTrustTTL()
+
+	device := models.TrustedDevice{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		Name:       name,
+		IP:         ip,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	token := services.SignToken(deviceTrustPurpose, device.ID.Hex()+":"+user.ID.Hex(), ttl)
+	device.TokenHash = services.HashToken(token)
+
+	if _, err := dc.TrustedDeviceCollection.InsertOne(ctx, device); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// IsTrusted reports whether the token was issued to this user and is still valid
+func (dc *DeviceController) IsTrusted(ctx context.Context, user models.User, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	payload, err := services.VerifyToken(deviceTrustPurpose, token)
+	if err != nil {
+		return false
+	}
+
+	deviceHex, userHex, _ := strings.Cut(payload, ":")
+	if userHex != user.ID.Hex() {
+		return false
+	}
+
+	deviceID, err := primitive.ObjectIDFromHex(deviceHex)
+	if err != nil {
+		return false
+	}
+
+	result := dc.TrustedDeviceCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":       deviceID,
+			"userId":    user.ID,
+			"tokenHash": services.HashToken(token),
+			"expiresAt": bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{"lastUsedAt": time.Now()}},
+	)
+	return result.Err() == nil
+}
+
+func (dc *DeviceController) ListTrustedDevices(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, dc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	cursor, err := dc.TrustedDeviceCollection.Find(ctx,
+		bson.M{"userId": user.ID, "expiresAt": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.M{"lastUsedAt": -1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	devices := []models.TrustedDevice{}
+	if err := cursor.All(ctx, &devices); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+func (dc *DeviceController) RevokeTrustedDevice(c *gin.Context) {
+	deviceID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, dc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result, err := dc.TrustedDeviceCollection.DeleteOne(ctx, bson.M{"_id": deviceID, "userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device revoked"})
+}
+
+func (dc *DeviceController) RevokeAllTrustedDevices(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, dc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result, err := dc.TrustedDeviceCollection.DeleteMany(ctx, bson.M{"userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Devices revoked", "revoked": result.DeletedCount})
+}
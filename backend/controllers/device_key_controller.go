@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const deviceChallengeTTL = 2 * time.Minute
+
+// SetupDeviceKeyIndexes keeps one key per user device and expires old challenges
+func SetupDeviceKeyIndexes(keys, challenges *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := keys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "deviceId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("Failed to create device key indexes:", err)
+	}
+
+	_, err = challenges.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println("Failed to create device challenge indexes:", err)
+	}
+}
+
+// RegisterDeviceKey stores the public half of a key pair generated in the device
+// keystore. A key signs in without the email code, so adding one takes step-up
+// verification and the user is told about it.
+func (dc *DeviceController) RegisterDeviceKey(c *gin.Context) {
+	var input struct {
+		DeviceID  string `json:"deviceId"`
+		Name      string `json:"name"`
+		PublicKey string `json:"publicKey"` // base64 SubjectPublicKeyInfo
+		Code      string `json:"code"`
+		TOTPCode  string `json:"totpCode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.DeviceID == "" || input.PublicKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "deviceId and publicKey are required"})
+		return
+	}
+
+	algorithm, err := services.ParseDevicePublicKey(input.PublicKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, dc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := dc.SignInFlow.CodeController.verifyStepUp(ctx, user, input.Code, input.TOTPCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Re-registering a device replaces its previous key
+	var key models.DeviceKey
+	err = dc.DeviceKeyCollection.FindOneAndUpdate(ctx,
+		bson.M{"userId": user.ID, "deviceId": input.DeviceID},
+		bson.M{
+			"$set": bson.M{
+				"name":      input.Name,
+				"algorithm": algorithm,
+				"publicKey": input.PublicKey,
+				"createdAt": time.Now(),
+			},
+			"$unset": bson.M{"lastUsedAt": ""},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device key"})
+		return
+	}
+
+	name := input.Name
+	if name == "" {
+		name = "A new device"
+	}
+	go sendSecurityEmail(user, "A device can now sign in to your account",
+		fmt.Sprintf("<h3>%s was set up for quick sign-in.</h3><p>IP address: %s<br>Time: %s</p><p>It can sign in without an email code. If this wasn't you, remove it and change your password now.</p>",
+			html.EscapeString(name), c.ClientIP(), time.Now().UTC().Format(time.RFC1123)))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device key registered", "key": key})
+}
+
+func (dc *DeviceController) ListDeviceKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, dc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	cursor, err := dc.DeviceKeyCollection.Find(ctx, bson.M{"userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.DeviceKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (dc *DeviceController) DeleteDeviceKey(c *gin.Context) {
+	keyID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, dc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result, err := dc.DeviceKeyCollection.DeleteOne(ctx, bson.M{"_id": keyID, "userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device key removed"})
+}
+
+// DeviceKeyChallenge issues a one-time challenge for a registered device to sign
+func (dc *DeviceController) DeviceKeyChallenge(c *gin.Context) {
+	var input struct {
+		Identifier string `json:"identifier"` // EID or Email
+		DeviceID   string `json:"deviceId"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Identifier == "" || input.DeviceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifier and deviceId are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	user, err := findUserByIdentifier(ctx, dc.UserCollection, input.Identifier)
+
+	var key models.DeviceKey
+	if err == nil {
+		err = dc.DeviceKeyCollection.FindOne(ctx, bson.M{"userId": user.ID, "deviceId": input.DeviceID}).Decode(&key)
+	}
+	if err != nil {
+		// an unknown account and an unknown device answer alike
+		if enumerationProtection() {
+			padResponse(start)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Device not registered"})
+		return
+	}
+
+	nonce, err := services.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+
+	challenge := models.DeviceKeyChallenge{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		KeyID:     key.ID,
+		Used:      false,
+		ExpiresAt: time.Now().Add(deviceChallengeTTL),
+	}
+	challenge.Challenge = "egoty-device-sign-in:" + challenge.ID.Hex() + ":" + nonce
+
+	if _, err := dc.DeviceChallengeCollection.InsertOne(ctx, challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challengeId": challenge.ID.Hex(),
+		"challenge":   challenge.Challenge,
+		"expiresAt":   challenge.ExpiresAt,
+	})
+}
+
+// DeviceKeySignIn verifies the signed challenge and issues a session. The
+// signature proves the device; risk and the sign_in policy can still ask for
+// more, and the challenge stays usable until they pass.
+func (dc *DeviceController) DeviceKeySignIn(c *gin.Context) {
+	var input struct {
+		ChallengeID string `json:"challengeId"`
+		Signature   string `json:"signature"` // base64 signature over the challenge string
+		RememberMe  bool   `json:"rememberMe"`
+		Code        string `json:"code"`
+		TOTPCode    string `json:"totpCode"`
+		SMSCode     string `json:"smsCode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.ChallengeID == "" || input.Signature == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "challengeId and signature are required"})
+		return
+	}
+
+	challengeID, err := primitive.ObjectIDFromHex(input.ChallengeID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid challenge"})
+		return
+	}
+
+	jkt, err := dpopBinding(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	usable := bson.M{"_id": challengeID, "used": false, "expiresAt": bson.M{"$gt": time.Now()}}
+
+	var challenge models.DeviceKeyChallenge
+	err = dc.DeviceChallengeCollection.FindOne(ctx, usable).Decode(&challenge)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var key models.DeviceKey
+	if err := dc.DeviceKeyCollection.FindOne(ctx, bson.M{"_id": challenge.KeyID, "userId": challenge.UserID}).Decode(&key); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Device not registered"})
+		return
+	}
+
+	if !services.VerifyDeviceSignature(key.PublicKey, challenge.Challenge, input.Signature) {
+		// a challenge gets one signature, right or wrong
+		_, _ = dc.DeviceChallengeCollection.UpdateOne(ctx, usable, bson.M{"$set": bson.M{"used": true}})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var user models.User
+	if err := dc.UserCollection.FindOne(ctx, bson.M{"_id": challenge.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
+	attempt := dc.SignInFlow.assess(ctx, user, c.ClientIP(), key.DeviceID, true)
+	codes := map[string]string{
+		models.FactorEmail: input.Code,
+		models.FactorTOTP:  input.TOTPCode,
+		models.FactorSMS:   input.SMSCode,
+	}
+	if !dc.SignInFlow.requireFactors(ctx, c, user, &attempt, nil, nil, codes) {
+		return
+	}
+
+	// Consume the challenge so a signature can never be replayed
+	result, err := dc.DeviceChallengeCollection.UpdateOne(ctx, usable, bson.M{"$set": bson.M{"used": true}})
+	if err != nil || result.ModifiedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	_, _ = dc.DeviceKeyCollection.UpdateOne(ctx, bson.M{"_id": key.ID}, bson.M{"$set": bson.M{"lastUsedAt": time.Now()}})
+
+	deletionCancelled, ok := dc.SignInFlow.finish(ctx, c, &user, attempt)
+	if !ok {
+		return
+	}
+
+	tokenString, err := issueSession(c, user, sessionOptions{RememberMe: input.RememberMe, JKT: jkt})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attempt.respond(gin.H{
+		"message":           "Sign in successful",
+		"token":             tokenString,
+		"user":              sessionUser(user),
+		"deletionCancelled": deletionCancelled,
+	}))
+}
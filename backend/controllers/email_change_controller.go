@@ -0,0 +1,446 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"flutter_project_backend/utils"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailChangeCancelPurpose = "email_change_cancel"
+	emailChangeCodeTTL       = 15 * time.Minute
+	emailChangeMaxAttempts   = 5
+)
+
+var (
+	errEmailTaken          = errors.New("email already in use")
+	errEmailChangeOutdated = errors.New("account email changed since the request")
+)
+
+type EmailChangeController struct {
+	UserCollection             *mongo.Collection
+	EmailChangeCollection      *mongo.Collection
+	EmailCodeCollection        *mongo.Collection
+	VerificationCodeCollection *mongo.Collection
+}
+
+func SetupEmailChangeIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "applyAt", Value: 1}}},
+	})
+	if err != nil {
+		log.Println("Failed to create email change indexes:", err)
+	}
+}
+
+// emailChangeCoolingOff reads EMAIL_CHANGE_COOLING_OFF_HOURS, defaulting to 24 hours
+func emailChangeCoolingOff() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("EMAIL_CHANGE_COOLING_OFF_HOURS"))
+	if err != nil || hours < 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func emailChangeCancelURL(change models.EmailChange) string {
+	token := services.SignToken(emailChangeCancelPurpose, change.ID.Hex(), time.Until(change.ExpiresAt.Add(emailChangeCoolingOff())))
+	return publicAPIURL() + "/account/email-change/cancel?token=" + url.QueryEscape(token)
+}
+
+// RequestEmailChange sends a code to the new address and a notice with a cancel
+// link to the current one. Any earlier unfinished change is replaced.
+func (ec *EmailChangeController) RequestEmailChange(c *gin.Context) {
+	var input struct {
+		NewEmail string `json:"newEmail"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.NewEmail == "" || input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "newEmail and password are required"})
+		return
+	}
+
+	newEmail := strings.TrimSpace(strings.ToLower(input.NewEmail))
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ec.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	if newEmail == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+
+	if err := ec.UserCollection.FindOne(ctx, bson.M{"email": newEmail}).Err(); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	_, err = ec.EmailChangeCollection.UpdateMany(ctx,
+		bson.M{"userId": user.ID, "status": bson.M{"$in": []string{models.EmailChangePending, models.EmailChangeConfirmed}}},
+		bson.M{"$set": bson.M{"status": models.EmailChangeCancelled}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	code := utils.GenerateCode(6)
+	now := time.Now()
+	change := models.EmailChange{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		OldEmail:  user.Email,
+		NewEmail:  newEmail,
+		CodeHash:  services.HashToken(code),
+		Status:    models.EmailChangePending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailChangeCodeTTL),
+	}
+
+	if _, err := ec.EmailChangeCollection.InsertOne(ctx, change); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start email change"})
+		return
+	}
+
+	if err := services.SendEmail(newEmail, "Confirm your new email address",
+		fmt.Sprintf("<h3>Your email confirmation code is: <b>%s</b></h3><p>It expires in %d minutes.</p>", code, int(emailChangeCodeTTL.Minutes())),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
+		return
+	}
+
+	go sendSecurityEmail(user, "Your email address is being changed", fmt.Sprintf(
+		`<h3>Someone asked to change your account email to %s.</h3><p>If this wasn't you, <a href="%s">cancel the change</a>.</p>`,
+		html.EscapeString(newEmail), emailChangeCancelURL(change),
+	))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Confirmation code sent to the new address", "change": change})
+}
+
+// ConfirmEmailChange checks the code sent to the new address and starts the cooling-off period
+func (ec *EmailChangeController) ConfirmEmailChange(c *gin.Context) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ec.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var change models.EmailChange
+	err = ec.EmailChangeCollection.FindOne(ctx, bson.M{
+		"userId":    user.ID,
+		"status":    models.EmailChangePending,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&change)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending email change"})
+		return
+	}
+
+	if change.Attempts >= emailChangeMaxAttempts || services.HashToken(input.Code) != change.CodeHash {
+		_, _ = ec.EmailChangeCollection.UpdateOne(ctx, bson.M{"_id": change.ID}, bson.M{"$inc": bson.M{"attempts": 1}})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+		return
+	}
+
+	now := time.Now()
+	err = ec.EmailChangeCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": change.ID, "status": models.EmailChangePending},
+		bson.M{"$set": bson.M{
+			"status":      models.EmailChangeConfirmed,
+			"confirmedAt": now,
+			"applyAt":     now.Add(emailChangeCoolingOff()),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&change)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email change is no longer pending"})
+		return
+	}
+
+	go sendSecurityEmail(user, "Your email address will change", fmt.Sprintf(
+		`<h3>Your account email will change to %s on %s.</h3><p>If this wasn't you, <a href="%s">cancel the change</a> before then.</p>`,
+		html.EscapeString(change.NewEmail), change.ApplyAt.UTC().Format(time.RFC1123), emailChangeCancelURL(change),
+	))
+
+	c.JSON(http.StatusOK, gin.H{"message": "New email confirmed", "change": change})
+}
+
+// GetEmailChange returns the signed-in user's unfinished email change, if any
+func (ec *EmailChangeController) GetEmailChange(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ec.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var change models.EmailChange
+	err = ec.EmailChangeCollection.FindOne(ctx, bson.M{
+		"userId": user.ID,
+		"status": bson.M{"$in": []string{models.EmailChangePending, models.EmailChangeConfirmed}},
+	}).Decode(&change)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending email change"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"change": change})
+}
+
+// CancelOwnEmailChange lets the signed-in user drop their unfinished change
+func (ec *EmailChangeController) CancelOwnEmailChange(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, ec.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result, err := ec.EmailChangeCollection.UpdateMany(ctx,
+		bson.M{"userId": user.ID, "status": bson.M{"$in": []string{models.EmailChangePending, models.EmailChangeConfirmed}}},
+		bson.M{"$set": bson.M{"status": models.EmailChangeCancelled}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending email change"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email change cancelled"})
+}
+
+const emailChangeCancelPage = `<!DOCTYPE html>
+<html><head><meta name="viewport" content="width=device-width, initial-scale=1"><title>Cancel email change</title></head>
+<body style="font-family:sans-serif;max-width:480px;margin:40px auto;padding:0 16px">
+<h2>Cancel the email change?</h2>
+<p>Your account will keep using this email address.</p>
+<form method="POST" action="/account/email-change/cancel">
+<input type="hidden" name="token" value="%s">
+<button type="submit" style="padding:12px 24px;font-size:16px">Cancel the change</button>
+</form>
+</body></html>`
+
+// CancelEmailChangePage is where the cancel link in the notice lands; the
+// cancel itself is a POST so link scanners can't trigger it
+func (ec *EmailChangeController) CancelEmailChangePage(c *gin.Context) {
+	token := c.Query("token")
+	if _, err := services.VerifyToken(emailChangeCancelPurpose, token); err != nil {
+		c.Data(http.StatusBadRequest, "text/html; charset=utf-8", []byte("<p>This link is invalid or has expired.</p>"))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(fmt.Sprintf(emailChangeCancelPage, html.EscapeString(token))))
+}
+
+// CancelEmailChange cancels the change behind a link sent to the old address.
+// No sign-in is needed, since whoever started the change may hold the session.
+func (ec *EmailChangeController) CancelEmailChange(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		var input struct {
+			Token string `json:"token"`
+		}
+		_ = c.ShouldBindJSON(&input)
+		token = input.Token
+	}
+
+	changeHex, err := services.VerifyToken(emailChangeCancelPurpose, token)
+	if err != nil {
+		ec.cancelResponse(c, http.StatusBadRequest, "This link is invalid or has expired.")
+		return
+	}
+	changeID, err := primitive.ObjectIDFromHex(changeHex)
+	if err != nil {
+		ec.cancelResponse(c, http.StatusBadRequest, "This link is invalid or has expired.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var change models.EmailChange
+	err = ec.EmailChangeCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": changeID, "status": bson.M{"$in": []string{models.EmailChangePending, models.EmailChangeConfirmed}}},
+		bson.M{"$set": bson.M{"status": models.EmailChangeCancelled}},
+	).Decode(&change)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		ec.cancelResponse(c, http.StatusConflict, "This email change has already been applied or cancelled.")
+		return
+	} else if err != nil {
+		ec.cancelResponse(c, http.StatusInternalServerError, "Something went wrong, please try again.")
+		return
+	}
+
+	ec.cancelResponse(c, http.StatusOK, "The email change was cancelled. If you didn't start it, change your password now.")
+}
+
+// cancelResponse answers the browser form with HTML and API clients with JSON
+func (ec *EmailChangeController) cancelResponse(c *gin.Context, status int, message string) {
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		if status == http.StatusOK {
+			c.JSON(status, gin.H{"message": message})
+		} else {
+			c.JSON(status, gin.H{"error": message})
+		}
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", []byte("<p>"+html.EscapeString(message)+"</p>"))
+}
+
+// StartEmailChangeApplier applies confirmed changes whose cooling-off period
+// has ended, once at startup and then every interval.
+func StartEmailChangeApplier(ec *EmailChangeController, interval time.Duration) {
+	go func() {
+		for {
+			ec.applyDueEmailChanges()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func (ec *EmailChangeController) applyDueEmailChanges() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := ec.EmailChangeCollection.Find(ctx, bson.M{
+		"status":  models.EmailChangeConfirmed,
+		"applyAt": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		log.Println("Failed to load due email changes:", err)
+		return
+	}
+
+	var changes []models.EmailChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		log.Println("Failed to load due email changes:", err)
+		return
+	}
+
+	for _, change := range changes {
+		err := ec.applyEmailChange(ctx, change)
+		switch {
+		case errors.Is(err, errEmailTaken):
+			_, _ = ec.EmailChangeCollection.UpdateOne(ctx, bson.M{"_id": change.ID}, bson.M{"$set": bson.M{"status": models.EmailChangeFailed}})
+			services.QueueEmail(change.OldEmail, "Your email address was not changed",
+				"<h3>The new email address was registered by another account before the change could apply, so your email was not changed.</h3>")
+		case errors.Is(err, errEmailChangeOutdated):
+			_, _ = ec.EmailChangeCollection.UpdateOne(ctx, bson.M{"_id": change.ID}, bson.M{"$set": bson.M{"status": models.EmailChangeFailed}})
+		case err != nil:
+			// left confirmed, the next run retries it
+			log.Printf("Failed to apply email change %s: %v", change.ID.Hex(), err)
+		default:
+			services.QueueEmail(change.OldEmail, "Your email address was changed", fmt.Sprintf(
+				"<h3>Your account email is now %s.</h3><p>You have been signed out everywhere. If this wasn't you, contact support immediately.</p>",
+				html.EscapeString(change.NewEmail),
+			))
+			services.QueueEmail(change.NewEmail, "Your email address was changed",
+				"<h3>This is now the email address for your account.</h3><p>Sign in again with it on your devices.</p>")
+		}
+	}
+}
+
+// applyEmailChange moves every email-keyed reference to the new address in one
+// transaction and revokes all sessions, since tokens carry the old email
+func (ec *EmailChangeController) applyEmailChange(ctx context.Context, change models.EmailChange) error {
+	session, err := ec.UserCollection.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := ec.UserCollection.FindOne(sc, bson.M{"email": change.NewEmail}).Err(); err == nil {
+			return nil, errEmailTaken
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		now := time.Now()
+		result, err := ec.UserCollection.UpdateOne(sc,
+			bson.M{"_id": change.UserID, "email": change.OldEmail},
+			bson.M{"$set": bson.M{"email": change.NewEmail, "sessionsRevokedAt": now}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, errEmailChangeOutdated
+		}
+
+		if _, err := ec.EmailCodeCollection.DeleteMany(sc, bson.M{"email": bson.M{"$in": []string{change.OldEmail, change.NewEmail}}}); err != nil {
+			return nil, err
+		}
+		// codes mailed to the old address stop working
+		if _, err := ec.VerificationCodeCollection.DeleteMany(sc, bson.M{"userId": change.UserID}); err != nil {
+			return nil, err
+		}
+
+		_, err = ec.EmailChangeCollection.UpdateOne(sc,
+			bson.M{"_id": change.ID, "status": models.EmailChangeConfirmed},
+			bson.M{"$set": bson.M{"status": models.EmailChangeApplied}},
+		)
+		return nil, err
+	})
+	return err
+}
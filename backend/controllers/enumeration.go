@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/services"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Account-enumeration protection. With ENUMERATION_PROTECTION on, the public
+// lookup and code-sending endpoints answer the same way, in about the same
+// time, whether or not the account exists, and every endpoint that takes an
+// identifier answers an unknown account like a wrong password or code.
+// Emails and texts only go to real accounts.
+
+const (
+	genericCodeMessage        = "If an account matches, we've sent it a code"
+	genericEIDMessage         = "If an account uses this email, we've sent its EID there"
+	genericLinkMessage        = "If an account matches, we've sent it a sign-in link"
+	genericCredentialsMessage = "Invalid credentials"
+	invalidCodeMessage        = "Invalid or expired code"
+)
+
+// enumerationProtection reads ENUMERATION_PROTECTION
+func enumerationProtection() bool {
+	on, _ := strconv.ParseBool(os.Getenv("ENUMERATION_PROTECTION"))
+	return on
+}
+
+// enumerationFloor reads ENUMERATION_MIN_RESPONSE_MS, the least time a
+// protected response takes, defaulting to 500ms
+func enumerationFloor() time.Duration {
+	ms, err := strconv.Atoi(os.Getenv("ENUMERATION_MIN_RESPONSE_MS"))
+	if err != nil || ms < 0 {
+		ms = 500
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// hideUnknownAccount reports whether a failed identifier lookup has to be
+// answered like a wrong password or code: protection is on and there's no
+// such account. Malformed input and database errors are still told apart.
+func hideUnknownAccount(err error) bool {
+	return enumerationProtection() && errors.Is(err, services.ErrAccountNotFound)
+}
+
+// credentialsRejected answers a sign-in whose account or password didn't check
+// out. With protection on both get the same message after the same delay.
+func credentialsRejected(c *gin.Context, start time.Time, message string) {
+	if enumerationProtection() {
+		padResponse(start)
+		message = genericCredentialsMessage
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// padResponse sleeps until the floor (plus a little jitter) has passed since start,
+// so a fast "no such account" path can't be told apart from a slow real one
+func padResponse(start time.Time) {
+	target := enumerationFloor() + time.Duration(rand.Int63n(int64(50*time.Millisecond)))
+	if wait := target - time.Since(start); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// burnPasswordCheck costs the same as checking a real password hash
+func burnPasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// dummyCodeLookup mirrors the read of a code collection a real send or check would make
+func dummyCodeLookup(codes *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = codes.FindOne(ctx, bson.M{"_id": primitive.NilObjectID}).Err()
+}
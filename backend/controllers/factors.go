@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"flutter_project_backend/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Verification of the factors a security policy can require (see models.Factors).
+
+const (
+	smsCodeTTL         = 5 * time.Minute
+	smsCodeCooldown    = time.Minute
+	smsCodeMaxAttempts = 5
+)
+
+var (
+	errFactorCodeRequired = errors.New("verification code is required")
+	errFactorCodeInvalid  = errors.New("invalid or expired verification code")
+	errFactorUnavailable  = errors.New("this verification method isn't set up for the account")
+	errSMSNotSent         = errors.New("failed to send SMS")
+)
+
+// SetupSMSCodeIndexes lets Mongo drop SMS codes once they expire
+func SetupSMSCodeIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.M{"userId": 1}},
+	})
+	if err != nil {
+		log.Println("Failed to create SMS code indexes:", err)
+	}
+}
+
+// factorAvailable reports whether the user can verify with the factor at all
+func factorAvailable(user models.User, factor string) bool {
+	switch factor {
+	case models.FactorTOTP:
+		return user.TwoFASecret != ""
+	case models.FactorEmail:
+		return true
+	case models.FactorSMS:
+		return user.Phone != ""
+	}
+	return false
+}
+
+// checkFactor verifies one factor's code. An email code must have been sent
+// for purpose. Email and SMS codes are used up on success.
+func (cc *CodeController) checkFactor(ctx context.Context, user models.User, factor, code, purpose string) error {
+	if code == "" {
+		return errFactorCodeRequired
+	}
+	if !factorAvailable(user, factor) {
+		return errFactorUnavailable
+	}
+
+	switch factor {
+	case models.FactorTOTP:
+		if !services.VerifyTOTP(user.TwoFASecret, code) {
+			return errFactorCodeInvalid
+		}
+		return nil
+
+	case models.FactorEmail:
+		return cc.verifyPurposeCode(ctx, user, purpose, code, true)
+
+	case models.FactorSMS:
+		var smsCode models.SMSCode
+		err := cc.SMSCodeCollection.FindOne(ctx, bson.M{
+			"userId":    user.ID,
+			"purpose":   bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": time.Now()},
+			"attempts":  bson.M{"$lt": smsCodeMaxAttempts},
+		}).Decode(&smsCode)
+		if err != nil {
+			return errFactorCodeInvalid
+		}
+		if services.HashToken(code) != smsCode.CodeHash {
+			_, _ = cc.SMSCodeCollection.UpdateOne(ctx, bson.M{"_id": smsCode.ID}, bson.M{"$inc": bson.M{"attempts": 1}})
+			return errFactorCodeInvalid
+		}
+		_, _ = cc.SMSCodeCollection.DeleteOne(ctx, bson.M{"_id": smsCode.ID})
+		return nil
+	}
+
+	return errFactorUnavailable
+}
+
+// SendSMSCode texts a verification code to the account's phone, for flows whose
+// security policy requires the SMS factor
+func (cc *CodeController) SendSMSCode(c *gin.Context) {
+	var input struct {
+		Identifier string `json:"identifier"` // EID or Email
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Identifier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifier required"})
+		return
+	}
+
+	if !requireCodePow(c, cc.PowVerifier, powScopeSendSMSCode) {
+		return
+	}
+
+	if enumerationProtection() {
+		cc.sendSMSCodeUniformly(c, input.Identifier)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, input.Identifier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account not found"})
+		return
+	}
+
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
+	if user.Phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No phone number on the account"})
+		return
+	}
+
+	remaining, err := cc.sendFactorSMS(ctx, user)
+	if remaining > 0 {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another code", "cooldown": int(remaining.Seconds())})
+		return
+	} else if errors.Is(err, errSMSNotSent) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send SMS"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Code sent", "cooldown": int(smsCodeCooldown.Seconds())})
+}
+
+// sendSMSCodeUniformly is SendSMSCode under enumeration protection: the text
+// goes out in the background if there's a phone to send it to, and every
+// well-formed identifier gets the same answer after the same delay
+func (cc *CodeController) sendSMSCodeUniformly(c *gin.Context, identifier string) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := findUserByIdentifier(ctx, cc.UserCollection, identifier)
+	switch {
+	case err == nil && !user.IsFrozen() && user.Phone != "":
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if _, err := cc.sendFactorSMS(ctx, user); err != nil {
+				log.Printf("Failed to send SMS code: %v", err)
+			}
+		}()
+	case err == nil, errors.Is(err, services.ErrAccountNotFound):
+		go dummyCodeLookup(cc.SMSCodeCollection)
+	case isIdentifierInputError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	padResponse(start)
+	c.JSON(http.StatusOK, gin.H{"message": genericCodeMessage, "cooldown": int(smsCodeCooldown.Seconds())})
+}
+
+// sendFactorSMS texts the user a new SMS factor code. While the last one is
+// still cooling down it sends nothing and returns the time left.
+func (cc *CodeController) sendFactorSMS(ctx context.Context, user models.User) (time.Duration, error) {
+	factorCode := bson.M{"userId": user.ID, "purpose": bson.M{"$exists": false}}
+
+	var last models.SMSCode
+	if err := cc.SMSCodeCollection.FindOne(ctx, factorCode).Decode(&last); err == nil {
+		if remaining := smsCodeCooldown - time.Since(last.SentAt); remaining > 0 {
+			return remaining, nil
+		}
+	}
+
+	code := utils.GenerateCode(6)
+	now := time.Now()
+	_, err := cc.SMSCodeCollection.UpdateOne(ctx,
+		factorCode,
+		bson.M{"$set": bson.M{
+			"codeHash":  services.HashToken(code),
+			"attempts":  0,
+			"sentAt":    now,
+			"expiresAt": now.Add(smsCodeTTL),
+		}, "$setOnInsert": bson.M{"_id": primitive.NewObjectID()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := services.SendSMS(user.Phone, code); err != nil {
+		log.Printf("Failed to send SMS code: %v", err)
+		return 0, errSMSNotSent
+	}
+	return 0, nil
+}
+
+// SendStepUpCode emails the signed-in user a code for step-up verification
+func (cc *CodeController) SendStepUpCode(c *gin.Context) {
+	if !requireCodePow(c, cc.PowVerifier, powScopeStepUpCode) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, cc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	attempts, cooldown, err := cc.sendPurposeCode(ctx, user, models.CodePurposeStepUp,
+		"Your Verification Code",
+		"<h3>Your verification code is: <b>%s</b></h3><p>If you didn't request it, change your password now.</p>",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempts": attempts,
+		"cooldown": int(cooldown.Seconds()),
+	})
+}
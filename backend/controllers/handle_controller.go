@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetupHandleIndexes keeps handles unique; they're stored lowercase, which
+// makes them case-insensitive
+func SetupHandleIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"handle": 1},
+		Options: options.Index().
+			SetName("unique_handle").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"handle": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		log.Println("Failed to create handle index:", err)
+	}
+}
+
+// CheckHandle tells the signup or settings screen whether a handle can be claimed
+func (uc *UserController) CheckHandle(c *gin.Context) {
+	var input struct {
+		Handle string `json:"handle"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Handle == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Handle is required"})
+		return
+	}
+
+	handle, err := services.ValidateNewHandle(input.Handle)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"available": false, "error": err.Error()})
+		return
+	}
+
+	taken, err := uc.UserCollection.CountDocuments(context.TODO(), bson.M{"handle": handle})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"available": taken == 0, "handle": handle})
+}
+
+// SetHandle claims a handle or renames the current one. After a change the
+// handle is locked for HANDLE_RENAME_COOLDOWN_DAYS.
+func (uc *UserController) SetHandle(c *gin.Context) {
+	var input struct {
+		Handle string `json:"handle"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Handle == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Handle is required"})
+		return
+	}
+
+	handle, err := services.ValidateNewHandle(input.Handle)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Handle == handle {
+		c.JSON(http.StatusOK, gin.H{"user": models.NewUserResponse(user)})
+		return
+	}
+
+	if !handleChangeAllowed(c, user) {
+		return
+	}
+
+	err = uc.UserCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"handle": handle, "handleChangedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Handle is already taken"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update handle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": models.NewUserResponse(user)})
+}
+
+// RemoveHandle releases the user's handle. It counts as a change for the cooldown.
+func (uc *UserController) RemoveHandle(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Handle == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No handle set"})
+		return
+	}
+
+	if !handleChangeAllowed(c, user) {
+		return
+	}
+
+	_, err = uc.UserCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$unset": bson.M{"handle": ""}, "$set": bson.M{"handleChangedAt": time.Now()}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove handle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Handle removed"})
+}
+
+// handleChangeAllowed answers 429 if the user changed their handle too recently
+func handleChangeAllowed(c *gin.Context, user models.User) bool {
+	if user.HandleChangedAt.IsZero() {
+		return true
+	}
+	availableAt := user.HandleChangedAt.Add(services.HandleRenameCooldown())
+	if time.Now().Before(availableAt) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "You changed your handle recently, try again later", "availableAt": availableAt})
+		return false
+	}
+	return true
+}
+
+// LookupUser is the public "who am I paying" lookup. It takes an @handle or an
+// EID and returns only a display name and avatar.
+func (uc *UserController) LookupUser(c *gin.Context) {
+	id, err := services.ClassifyIdentifier(c.Param("identifier"))
+	if err == nil && id.Kind != services.IdentifierHandle && id.Kind != services.IdentifierEID {
+		err = errors.New("look up users by @handle or EID")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the answer shows whether an account exists, so with enumeration
+	// protection on it costs a proof of work and takes as long either way
+	protected := enumerationProtection()
+	if protected && !requirePow(c, uc.PowVerifier, powScopeLookupUser) {
+		return
+	}
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, _, err := services.IdentifierResolver{Users: uc.UserCollection}.Resolve(ctx, c.Param("identifier"))
+	if protected {
+		padResponse(start)
+	}
+	if err != nil || user.IsFrozen() || user.IsPendingDeletion() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"displayName": maskName(user.FirstName, user.LastName),
+		"avatarUrl":   user.AvatarURL,
+	})
+}
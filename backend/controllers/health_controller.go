@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	EIDAllocator *services.EIDAllocator
+}
+
+// EIDPoolHealth reports the reserved EID pool. It answers 503 while the pool
+// is empty, when new accounts get locally generated EIDs.
+func (hc *HealthController) EIDPoolHealth(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stats, err := hc.EIDAllocator.Stats(ctx)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "down", "error": "Database error"})
+		return
+	}
+
+	if stats.Depth == 0 && stats.Target > 0 && stats.Upstream != "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "eidPool": stats})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "eidPool": stats})
+}
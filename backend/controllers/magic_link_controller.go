@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	magicLinkPurpose     = "magic_link"
+	magicLinkNonceCookie = "magic_link_nonce"
+)
+
+type MagicLinkController struct {
+	UserCollection      *mongo.Collection
+	MagicLinkCollection *mongo.Collection
+	SignInFlow          *SignInFlow
+	PowVerifier         *services.PowVerifier
+}
+
+// SetupMagicLinkIndexes removes magic links once they expire
+func SetupMagicLinkIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println("Failed to create magic link indexes:", err)
+	}
+}
+
+// magicLinkTTL reads MAGIC_LINK_TTL_MINUTES, defaulting to 10 minutes
+func magicLinkTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("MAGIC_LINK_TTL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 10
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// magicLinkURL builds the link from MAGIC_LINK_URL, which may be an https page or an app deep link
+func magicLinkURL(token string) string {
+	base := os.Getenv("MAGIC_LINK_URL")
+	if base == "" {
+		base = "egoty://magic-link"
+	}
+
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+// RequestMagicLink emails a sign-in link and hands the requesting device the nonce that unlocks it
+func (mc *MagicLinkController) RequestMagicLink(c *gin.Context) {
+	var input struct {
+		Identifier string `json:"identifier"` // EID or Email
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Identifier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifier required"})
+		return
+	}
+
+	if !requireCodePow(c, mc.PowVerifier, powScopeMagicLink) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	user, err := findUserByIdentifier(ctx, mc.UserCollection, input.Identifier)
+
+	// with enumeration protection an unknown or frozen account gets a nonce
+	// that unlocks nothing, so the answer looks like a real one
+	if hideUnknownAccount(err) || (err == nil && user.IsFrozen() && enumerationProtection()) {
+		nonce, err := services.RandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
+			return
+		}
+		linkSent(c, nonce, time.Now().Add(magicLinkTTL()), start)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": identifierError(err)})
+		return
+	}
+
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
+	nonce, err := services.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
+		return
+	}
+
+	ttl := magicLinkTTL()
+	now := time.Now()
+	link := models.MagicLink{
+		ID:              primitive.NewObjectID(),
+		UserID:          user.ID,
+		DeviceNonceHash: services.HashToken(nonce),
+		IP:              c.ClientIP(),
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(ttl),
+	}
+	token := services.SignToken(magicLinkPurpose, link.ID.Hex(), ttl)
+	link.TokenHash = services.HashToken(token)
+
+	if _, err := mc.MagicLinkCollection.InsertOne(ctx, link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	body := fmt.Sprintf(`<h3>Tap the link below on the device where you requested it to sign in.</h3><p><a href="%s">Sign in</a></p><p>The link expires in %d minutes and can only be used once.</p>`,
+		magicLinkURL(token), int(ttl.Minutes()))
+
+	// a protected answer can't wait on the mail server, or its timing would tell
+	if enumerationProtection() {
+		services.QueueEmail(user.Email, "Your Sign-in Link", body)
+	} else if err := services.SendEmail(user.Email, "Your Sign-in Link", body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send email"})
+		return
+	}
+
+	linkSent(c, nonce, link.ExpiresAt, start)
+}
+
+// linkSent hands the requesting device its nonce. With enumeration protection
+// the message is generic and the answer padded, whether or not a link went out.
+func linkSent(c *gin.Context, nonce string, expiresAt, start time.Time) {
+	message := "Sign-in link sent"
+	if enumerationProtection() {
+		padResponse(start)
+		message = genericLinkMessage
+	}
+
+	// Browsers get the nonce as a cookie; apps keep deviceNonce and send it on redeem
+	c.SetCookie(magicLinkNonceCookie, nonce, int(time.Until(expiresAt).Seconds()), "/", "", false, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     message,
+		"deviceNonce": nonce,
+		"expiresAt":   expiresAt,
+	})
+}
+
+// RedeemMagicLink exchanges a link token plus the device nonce for a session, once.
+// The link stands in for the email code; risk and the security policy can
+// still ask for TOTP or SMS, and the link survives until those pass.
+func (mc *MagicLinkController) RedeemMagicLink(c *gin.Context) {
+	var input struct {
+		Token       string `json:"token"`
+		DeviceNonce string `json:"deviceNonce"`
+		RememberMe  bool   `json:"rememberMe"`
+		DeviceID    string `json:"deviceId"`
+		TOTPCode    string `json:"totpCode"`
+		SMSCode     string `json:"smsCode"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	if input.Token == "" {
+		input.Token = c.Query("token")
+	}
+	if input.DeviceNonce == "" {
+		input.DeviceNonce, _ = c.Cookie(magicLinkNonceCookie)
+	}
+	if input.Token == "" || input.DeviceNonce == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token and deviceNonce are required"})
+		return
+	}
+
+	jkt, err := dpopBinding(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	linkHex, err := services.VerifyToken(magicLinkPurpose, input.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	linkID, err := primitive.ObjectIDFromHex(linkHex)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The nonce is part of the filter so a forwarded link can't be used or burned
+	now := time.Now()
+	usable := bson.M{
+		"_id":             linkID,
+		"tokenHash":       services.HashToken(input.Token),
+		"deviceNonceHash": services.HashToken(input.DeviceNonce),
+		"usedAt":          bson.M{"$exists": false},
+		"expiresAt":       bson.M{"$gt": now},
+	}
+
+	var link models.MagicLink
+	if err := mc.MagicLinkCollection.FindOne(ctx, usable).Decode(&link); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	var user models.User
+	if err := mc.UserCollection.FindOne(ctx, bson.M{"_id": link.UserID}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
+	attempt := mc.SignInFlow.assess(ctx, user, c.ClientIP(), input.DeviceID, false)
+	codes := map[string]string{
+		models.FactorTOTP: input.TOTPCode,
+		models.FactorSMS:  input.SMSCode,
+	}
+	if !mc.SignInFlow.requireFactors(ctx, c, user, &attempt, nil, []string{models.FactorEmail}, codes) {
+		return
+	}
+
+	// Single use: only one redeem gets past this
+	result, err := mc.MagicLinkCollection.UpdateOne(ctx, usable, bson.M{"$set": bson.M{"usedAt": now}})
+	if err != nil || result.ModifiedCount == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	deletionCancelled, ok := mc.SignInFlow.finish(ctx, c, &user, attempt)
+	if !ok {
+		return
+	}
+
+	tokenString, err := issueSession(c, user, sessionOptions{RememberMe: input.RememberMe, JKT: jkt})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.SetCookie(magicLinkNonceCookie, "", -1, "/", "", false, true)
+
+	c.JSON(http.StatusOK, attempt.respond(gin.H{
+		"message":           "Sign in successful",
+		"token":             tokenString,
+		"user":              sessionUser(user),
+		"deletionCancelled": deletionCancelled,
+	}))
+}
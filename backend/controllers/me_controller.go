@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetMe returns the signed-in user's profile
+func (uc *UserController) GetMe(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": models.NewUserResponse(user)})
+}
+
+// UpdateMe changes any of the given profile fields. Every field is validated
+// and nothing is saved unless all of them pass; failures come back per field.
+func (uc *UserController) UpdateMe(c *gin.Context) {
+	var input struct {
+		FirstName   *string `json:"firstName"`
+		LastName    *string `json:"lastName"`
+		Gender      *string `json:"gender"`
+		CountryID   *string `json:"countryId"`
+		LanguageID  *string `json:"languageId"`
+		DateOfBirth *string `json:"dob"`
+		AvatarURL   *string `json:"avatarUrl"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	set := bson.M{}
+	fieldErrors := gin.H{}
+
+	if input.FirstName != nil {
+		if name, err := services.NormalizeName(*input.FirstName); err != nil {
+			fieldErrors["firstName"] = "First name " + err.Error()
+		} else {
+			set["firstName"] = name
+		}
+	}
+
+	if input.LastName != nil {
+		if name, err := services.NormalizeName(*input.LastName); err != nil {
+			fieldErrors["lastName"] = "Last name " + err.Error()
+		} else {
+			set["lastName"] = name
+		}
+	}
+
+	if input.Gender != nil {
+		if gender, err := services.NormalizeGender(*input.Gender); err != nil {
+			fieldErrors["gender"] = "Gender " + err.Error()
+		} else {
+			set["gender"] = gender
+		}
+	}
+
+	if input.DateOfBirth != nil {
+		if dob, err := services.ParseDateOfBirth(*input.DateOfBirth); err != nil {
+			fieldErrors["dob"] = "Date of birth " + err.Error()
+		} else {
+			set["dob"] = dob
+		}
+	}
+
+	if input.AvatarURL != nil {
+		if avatar, err := services.NormalizeAvatarURL(*input.AvatarURL); err != nil {
+			fieldErrors["avatarUrl"] = "Avatar " + err.Error()
+		} else {
+			set["avatarUrl"] = avatar
+		}
+	}
+
+	if input.CountryID != nil {
+		var country models.Country
+		if err := uc.CountryCollection.FindOne(ctx, bson.M{"_id": strings.TrimSpace(*input.CountryID)}).Decode(&country); err != nil {
+			fieldErrors["countryId"] = "Unknown country"
+		} else {
+			set["country"] = country
+		}
+	}
+
+	if input.LanguageID != nil {
+		var language models.Language
+		if err := uc.LanguageCollection.FindOne(ctx, bson.M{"_id": strings.TrimSpace(*input.LanguageID)}).Decode(&language); err != nil {
+			fieldErrors["languageId"] = "Unknown language"
+		} else {
+			set["language"] = language
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "fields": fieldErrors})
+		return
+	}
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if len(set) > 0 {
+		err = uc.UserCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+
+		// the default profile mirrors the account's own preferences
+		if language, ok := set["language"].(models.Language); ok {
+			_, _ = uc.ProfileCollection.UpdateOne(ctx,
+				bson.M{"userId": user.ID, "isDefault": true},
+				bson.M{"$set": bson.M{"languageId": language.ID}},
+			)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": models.NewUserResponse(user)})
+}
@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"flutter_project_backend/utils"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Phone enrollment for the SMS factor. Adding a number takes step-up
+// verification and a code texted to that number; only then is it stored.
+
+// SetupPhoneIndexes keeps phone numbers unique, so a number signs in to one account
+func SetupPhoneIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"phone": 1},
+		Options: options.Index().
+			SetName("unique_phone").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"phone": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		log.Println("Failed to create phone index:", err)
+	}
+}
+
+// StartPhoneEnrollment texts a code to the number the user wants to add
+func (sc *SecurityPolicyController) StartPhoneEnrollment(c *gin.Context) {
+	var input struct {
+		Phone    string `json:"phone"`
+		Code     string `json:"code"`
+		TOTPCode string `json:"totpCode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "phone is required"})
+		return
+	}
+
+	phone, err := services.NormalizePhone(input.Phone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, sc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Phone == phone {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This number is already on your account"})
+		return
+	}
+
+	taken, err := sc.UserCollection.CountDocuments(ctx, bson.M{"phone": phone})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is used by another account"})
+		return
+	}
+
+	enrollCode := bson.M{"userId": user.ID, "purpose": models.SMSCodeEnrollPhone}
+
+	var last models.SMSCode
+	if err := sc.CodeController.SMSCodeCollection.FindOne(ctx, enrollCode).Decode(&last); err == nil {
+		if remaining := smsCodeCooldown - time.Since(last.SentAt); remaining > 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another code", "cooldown": int(remaining.Seconds())})
+			return
+		}
+	}
+
+	if err := sc.CodeController.verifyStepUp(ctx, user, input.Code, input.TOTPCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	code := utils.GenerateCode(6)
+	now := time.Now()
+	_, err = sc.CodeController.SMSCodeCollection.UpdateOne(ctx,
+		enrollCode,
+		bson.M{"$set": bson.M{
+			"phone":     phone,
+			"codeHash":  services.HashToken(code),
+			"attempts":  0,
+			"sentAt":    now,
+			"expiresAt": now.Add(smsCodeTTL),
+		}, "$setOnInsert": bson.M{"_id": primitive.NewObjectID()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := services.SendSMS(phone, code); err != nil {
+		log.Printf("Failed to send phone enrollment code: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send SMS"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Code sent", "cooldown": int(smsCodeCooldown.Seconds())})
+}
+
+// VerifyPhoneEnrollment stores the number once the texted code comes back
+func (sc *SecurityPolicyController) VerifyPhoneEnrollment(c *gin.Context) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || input.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, sc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var smsCode models.SMSCode
+	err = sc.CodeController.SMSCodeCollection.FindOne(ctx, bson.M{
+		"userId":    user.ID,
+		"purpose":   models.SMSCodeEnrollPhone,
+		"expiresAt": bson.M{"$gt": time.Now()},
+		"attempts":  bson.M{"$lt": smsCodeMaxAttempts},
+	}).Decode(&smsCode)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errFactorCodeInvalid.Error()})
+		return
+	}
+	if services.HashToken(input.Code) != smsCode.CodeHash {
+		_, _ = sc.CodeController.SMSCodeCollection.UpdateOne(ctx, bson.M{"_id": smsCode.ID}, bson.M{"$inc": bson.M{"attempts": 1}})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errFactorCodeInvalid.Error()})
+		return
+	}
+
+	err = sc.UserCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"phone": smsCode.Phone}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This number is used by another account"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update phone"})
+		return
+	}
+
+	_, _ = sc.CodeController.SMSCodeCollection.DeleteOne(ctx, bson.M{"_id": smsCode.ID})
+
+	go sendSecurityEmail(user, "A phone number was added to your account",
+		"<h3>A phone number can now receive verification codes for your account.</h3><p>If you didn't add it, change your password and remove the number now.</p>")
+
+	c.JSON(http.StatusOK, gin.H{"phone": user.Phone, "policy": policyResponse(user)})
+}
+
+// RemovePhone drops the number. It's refused while the security policy still
+// requires SMS for any action.
+func (sc *SecurityPolicyController) RemovePhone(c *gin.Context) {
+	var input struct {
+		Code     string `json:"code"`
+		TOTPCode string `json:"totpCode"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, sc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Phone == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No phone number on the account"})
+		return
+	}
+
+	for _, action := range models.PolicyActions {
+		if slices.Contains(user.RequiredFactors(action), models.FactorSMS) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Remove SMS from your security policy first", "action": action})
+			return
+		}
+	}
+
+	if err := sc.CodeController.verifyStepUp(ctx, user, input.Code, input.TOTPCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = sc.UserCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$unset": bson.M{"phone": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove phone"})
+		return
+	}
+
+	go sendSecurityEmail(user, "A phone number was removed from your account",
+		"<h3>Your phone number no longer receives verification codes.</h3><p>If you didn't remove it, change your password now.</p>")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone removed", "policy": policyResponse(user)})
+}
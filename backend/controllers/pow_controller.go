@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Proof-of-work scopes, one per protected endpoint
+const (
+	powScopeCheckEID      = "check-eid"
+	powScopeGetCode       = "get-code"
+	powScopeGetCodeSignIn = "get-code-sign-in"
+	powScopeSendResetCode = "send-reset-code"
+	powScopeSendEIDCode   = "send-eid-code"
+	powScopeForgotEID     = "forgot-eid"
+	powScopeLookupUser    = "lookup-user"
+	powScopeMagicLink     = "magic-link"
+	powScopeSendSMSCode   = "send-sms-code"
+	powScopeUnfreezeCode  = "unfreeze-code"
+	powScopeStepUpCode    = "step-up-code"
+	powScopeDeletionCode  = "deletion-code"
+)
+
+var powScopes = map[string]bool{
+	powScopeCheckEID:      true,
+	powScopeGetCode:       true,
+	powScopeGetCodeSignIn: true,
+	powScopeSendResetCode: true,
+	powScopeSendEIDCode:   true,
+	powScopeForgotEID:     true,
+	powScopeLookupUser:    true,
+	powScopeMagicLink:     true,
+	powScopeSendSMSCode:   true,
+	powScopeUnfreezeCode:  true,
+	powScopeStepUpCode:    true,
+	powScopeDeletionCode:  true,
+}
+
+type PowController struct{}
+
+// IssueChallenge hands out a proof-of-work challenge for one endpoint. The
+// difficulty goes up under load and for IPs that have been misbehaving.
+func (pc *PowController) IssueChallenge(c *gin.Context) {
+	var input struct {
+		Scope string `json:"scope"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || !powScopes[input.Scope] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope"})
+		return
+	}
+
+	difficulty := services.PowDifficultyFor(c.ClientIP())
+	challenge, err := services.IssuePowChallenge(input.Scope, difficulty)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge":  challenge,
+		"difficulty": difficulty,
+		"algorithm":  "sha256",
+		"expiresIn":  int(services.PowChallengeTTL.Seconds()),
+	})
+}
+
+// requirePow checks the X-PoW-Challenge and X-PoW-Solution headers, answering
+// 428 when they're missing or don't hold up
+func requirePow(c *gin.Context, verifier *services.PowVerifier, scope string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := verifier.Verify(ctx, scope, c.GetHeader("X-PoW-Challenge"), c.GetHeader("X-PoW-Solution"))
+	if err == nil {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, services.ErrPowInvalid), errors.Is(err, services.ErrPowReused):
+		services.FlagSuspiciousIP(c.ClientIP())
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error(), "powRequired": true, "scope": scope})
+	case errors.Is(err, services.ErrPowRequired):
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": err.Error(), "powRequired": true, "scope": scope})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+	return false
+}
+
+// requireCodePow guards the endpoints that send a (paid) email or SMS code
+// unless POW_REQUIRED is off
+func requireCodePow(c *gin.Context, verifier *services.PowVerifier, scope string) bool {
+	if !services.PowRequired() {
+		return true
+	}
+	return requirePow(c, verifier, scope)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"flutter_project_backend/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryPowRedemptions is a services.PowRedemptions for tests
+type memoryPowRedemptions map[string]time.Time
+
+func (m memoryPowRedemptions) Redeem(_ context.Context, id string, expiresAt time.Time) error {
+	if _, ok := m[id]; ok {
+		return services.ErrPowReused
+	}
+	m[id] = expiresAt
+	return nil
+}
+
+func powTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("POW_REQUIRED", "")
+	t.Setenv("POW_DIFFICULTY", "")
+
+	cc := &CodeController{PowVerifier: &services.PowVerifier{Used: memoryPowRedemptions{}}}
+	r := gin.New()
+	r.POST("/pow/challenge", (&PowController{}).IssueChallenge)
+	r.POST("/security/step-up/send-code", cc.SendStepUpCode)
+	return r
+}
+
+func powRequest(r *gin.Engine, path, ip string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.RemoteAddr = ip + ":40000"
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func issuedChallenge(t *testing.T, r *gin.Engine, ip string) (string, int) {
+	t.Helper()
+	w := powRequest(r, "/pow/challenge", ip, `{"scope":"step-up-code"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /pow/challenge from %s = %d %s", ip, w.Code, w.Body)
+	}
+	var resp struct {
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Challenge, resp.Difficulty
+}
+
+func TestRequireCodePowRejectsUnsolvedRequests(t *testing.T) {
+	r := powTestRouter(t)
+
+	w := powRequest(r, "/security/step-up/send-code", "198.51.100.10", "", nil)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("send-code without a proof of work = %d, want 428", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"powRequired":true`) {
+		t.Fatalf("send-code without a proof of work answered %s", w.Body)
+	}
+}
+
+func TestPowChallengeHarderForFlaggedIP(t *testing.T) {
+	r := powTestRouter(t)
+	const clean, suspect = "198.51.100.20", "198.51.100.21"
+
+	_, base := issuedChallenge(t, r, clean)
+
+	// a wrong solution is rejected and flags the IP that sent it
+	challenge, _ := issuedChallenge(t, r, suspect)
+	w := powRequest(r, "/security/step-up/send-code", suspect, "", map[string]string{
+		"X-PoW-Challenge": challenge,
+		"X-PoW-Solution":  "not-a-solution",
+	})
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("send-code with a wrong solution = %d, want 428", w.Code)
+	}
+
+	if _, flagged := issuedChallenge(t, r, suspect); flagged <= base {
+		t.Fatalf("difficulty for a flagged IP = %d, want more than %d", flagged, base)
+	}
+	if _, again := issuedChallenge(t, r, clean); again != base {
+		t.Fatalf("difficulty for a clean IP = %d, want %d", again, base)
+	}
+}
@@ -0,0 +1,428 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const maxProfilesPerAccount = 5
+
+type ProfileController struct {
+	UserCollection     *mongo.Collection
+	ProfileCollection  *mongo.Collection
+	LanguageCollection *mongo.Collection
+}
+
+// SetupProfileIndexes allows a single default profile per account
+func SetupProfileIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"userId": 1}},
+		{
+			Keys: bson.M{"userId": 1},
+			Options: options.Index().
+				SetName("one_default_profile").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"isDefault": true}),
+		},
+	})
+	if err != nil {
+		log.Println("Failed to create profile indexes:", err)
+	}
+}
+
+// profileResponse is the client view of a profile
+func profileResponse(profile models.Profile) gin.H {
+	return gin.H{
+		"id":           profile.ID,
+		"displayName":  profile.DisplayName,
+		"currencyCode": profile.CurrencyCode,
+		"languageId":   profile.LanguageID,
+		"isDefault":    profile.IsDefault,
+		"pinEnabled":   profile.Pin != "",
+		"createdAt":    profile.CreatedAt,
+		"updatedAt":    profile.UpdatedAt,
+	}
+}
+
+// ensureDefaultProfile returns the account's default profile, creating it from
+// the user's own details the first time
+func (pc *ProfileController) ensureDefaultProfile(ctx context.Context, user models.User) (models.Profile, error) {
+	var profile models.Profile
+	err := pc.ProfileCollection.FindOne(ctx, bson.M{"userId": user.ID, "isDefault": true}).Decode(&profile)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return profile, err
+	}
+
+	now := time.Now()
+	profile = models.Profile{
+		ID:           primitive.NewObjectID(),
+		UserID:       user.ID,
+		DisplayName:  strings.TrimSpace(user.FirstName + " " + user.LastName),
+		CurrencyCode: user.CurrencyCode,
+		LanguageID:   user.Language.ID,
+		IsDefault:    true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if _, err := pc.ProfileCollection.InsertOne(ctx, profile); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// another request created it first
+			err = pc.ProfileCollection.FindOne(ctx, bson.M{"userId": user.ID, "isDefault": true}).Decode(&profile)
+		}
+		return profile, err
+	}
+	return profile, nil
+}
+
+// validLanguage reports whether the id exists in the languages collection
+func (pc *ProfileController) validLanguage(ctx context.Context, languageID string) bool {
+	return pc.LanguageCollection.FindOne(ctx, bson.M{"_id": languageID}).Err() == nil
+}
+
+func (pc *ProfileController) ListProfiles(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, pc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	defaultProfile, err := pc.ensureDefaultProfile(ctx, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	cursor, err := pc.ProfileCollection.Find(ctx,
+		bson.M{"userId": user.ID},
+		options.Find().SetSort(bson.D{{Key: "isDefault", Value: -1}, {Key: "createdAt", Value: 1}}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var profiles []models.Profile
+	if err := cursor.All(ctx, &profiles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	activeID := defaultProfile.ID
+	if profileID, ok := currentProfileID(c); ok {
+		activeID = profileID
+	}
+
+	response := make([]gin.H, 0, len(profiles))
+	for _, profile := range profiles {
+		response = append(response, profileResponse(profile))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profiles": response, "activeProfileId": activeID})
+}
+
+func (pc *ProfileController) CreateProfile(c *gin.Context) {
+	var input struct {
+		DisplayName  string `json:"displayName"`
+		CurrencyCode string `json:"currencyCode"`
+		LanguageID   string `json:"languageId"`
+		Pin          string `json:"pin"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	input.DisplayName = strings.TrimSpace(input.DisplayName)
+	if input.DisplayName == "" || len(input.DisplayName) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Display name must be 1 to 50 characters"})
+		return
+	}
+
+	if input.Pin != "" {
+		if err := services.ValidateNewPin(input.Pin); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if input.LanguageID != "" && !pc.validLanguage(ctx, input.LanguageID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language"})
+		return
+	}
+
+	user, err := currentUser(ctx, c, pc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if _, err := pc.ensureDefaultProfile(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	count, err := pc.ProfileCollection.CountDocuments(ctx, bson.M{"userId": user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxProfilesPerAccount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Profile limit reached", "limit": maxProfilesPerAccount})
+		return
+	}
+
+	now := time.Now()
+	profile := models.Profile{
+		ID:           primitive.NewObjectID(),
+		UserID:       user.ID,
+		DisplayName:  input.DisplayName,
+		CurrencyCode: input.CurrencyCode,
+		LanguageID:   input.LanguageID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if input.Pin != "" {
+		hashedPin, err := bcrypt.GenerateFromPassword([]byte(input.Pin), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
+			return
+		}
+		profile.Pin = string(hashedPin)
+	}
+
+	if _, err := pc.ProfileCollection.InsertOne(ctx, profile); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create profile"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"profile": profileResponse(profile)})
+}
+
+// UpdateProfile changes the given fields. Changing or removing a profile PIN
+// needs the current one.
+func (pc *ProfileController) UpdateProfile(c *gin.Context) {
+	profileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile id"})
+		return
+	}
+
+	var input struct {
+		DisplayName  *string `json:"displayName"`
+		CurrencyCode *string `json:"currencyCode"`
+		LanguageID   *string `json:"languageId"`
+		Pin          string  `json:"pin"`
+		RemovePin    bool    `json:"removePin"`
+		CurrentPin   string  `json:"currentPin"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, pc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var profile models.Profile
+	if err := pc.ProfileCollection.FindOne(ctx, bson.M{"_id": profileID, "userId": user.ID}).Decode(&profile); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	unset := bson.M{}
+
+	if input.DisplayName != nil {
+		name := strings.TrimSpace(*input.DisplayName)
+		if name == "" || len(name) > 50 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Display name must be 1 to 50 characters"})
+			return
+		}
+		set["displayName"] = name
+	}
+	if input.CurrencyCode != nil {
+		set["currencyCode"] = *input.CurrencyCode
+	}
+	if input.LanguageID != nil {
+		if *input.LanguageID != "" && !pc.validLanguage(ctx, *input.LanguageID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language"})
+			return
+		}
+		set["languageId"] = *input.LanguageID
+	}
+
+	if input.Pin != "" || input.RemovePin {
+		if profile.Pin != "" {
+			if err := bcrypt.CompareHashAndPassword([]byte(profile.Pin), []byte(input.CurrentPin)); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid PIN"})
+				return
+			}
+		}
+
+		if input.RemovePin {
+			unset["pin"] = ""
+		} else {
+			if err := services.ValidateNewPin(input.Pin); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			hashedPin, err := bcrypt.GenerateFromPassword([]byte(input.Pin), bcrypt.DefaultCost)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
+				return
+			}
+			set["pin"] = string(hashedPin)
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	err = pc.ProfileCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": profile.ID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profileResponse(profile)})
+}
+
+// DeleteProfile removes a secondary profile. Tokens scoped to it stop working.
+func (pc *ProfileController) DeleteProfile(c *gin.Context) {
+	profileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, pc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var profile models.Profile
+	if err := pc.ProfileCollection.FindOne(ctx, bson.M{"_id": profileID, "userId": user.ID}).Decode(&profile); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+
+	if profile.IsDefault {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The default profile can't be deleted"})
+		return
+	}
+
+	if _, err := pc.ProfileCollection.DeleteOne(ctx, bson.M{"_id": profile.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile deleted"})
+}
+
+// SwitchProfile re-issues the session token scoped to the chosen profile,
+// keeping the current expiry and DPoP binding
+func (pc *ProfileController) SwitchProfile(c *gin.Context) {
+	profileID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile id"})
+		return
+	}
+
+	var input struct {
+		Pin string `json:"pin"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, pc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if _, err := pc.ensureDefaultProfile(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var profile models.Profile
+	if err := pc.ProfileCollection.FindOne(ctx, bson.M{"_id": profileID, "userId": user.ID}).Decode(&profile); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+
+	if profile.Pin != "" {
+		if input.Pin == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "PIN is required", "pinRequired": true})
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(profile.Pin), []byte(input.Pin)); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid PIN"})
+			return
+		}
+	}
+
+	opts := sessionOptions{ProfileID: profile.ID.Hex()}
+	if jkt, ok := c.Get("jkt"); ok {
+		opts.JKT = jkt.(string)
+	}
+	if exp, ok := c.Get("session_exp"); ok {
+		opts.ExpiresAt = exp.(time.Time)
+	}
+
+	tokenString, err := issueSession(c, user, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile switched",
+		"token":   tokenString,
+		"profile": profileResponse(profile),
+	})
+}
@@ -0,0 +1,448 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	loginRequestTTL   = 2 * time.Minute
+	loginPollTimeout  = 25 * time.Second
+	loginPollInterval = time.Second
+	maxPinFailures    = 5
+	pinLockDuration   = 15 * time.Minute
+)
+
+type QRLoginController struct {
+	UserCollection         *mongo.Collection
+	LoginRequestCollection *mongo.Collection
+	SignInFlow             *SignInFlow
+}
+
+// SetupLoginRequestIndexes removes QR login requests shortly after they expire
+func SetupLoginRequestIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(60),
+	})
+	if err != nil {
+		log.Println("Failed to create login request indexes:", err)
+	}
+}
+
+// randomTwoDigits returns a number between 10 and 99 as a string
+func randomTwoDigits() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(90))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", n.Int64()+10), nil
+}
+
+// numberChoices returns three distinct numbers, one of them the match number, in random order
+func numberChoices(match string) ([]string, error) {
+	choices := []string{match}
+	for len(choices) < 3 {
+		n, err := randomTwoDigits()
+		if err != nil {
+			return nil, err
+		}
+		duplicate := false
+		for _, c := range choices {
+			if c == n {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			choices = append(choices, n)
+		}
+	}
+
+	pos, err := rand.Int(rand.Reader, big.NewInt(3))
+	if err != nil {
+		return nil, err
+	}
+	i := int(pos.Int64())
+	choices[0], choices[i] = choices[i], choices[0]
+	return choices, nil
+}
+
+// CreateLoginRequest is called by the new device; it renders requestId as a QR code
+func (qc *QRLoginController) CreateLoginRequest(c *gin.Context) {
+	var input struct {
+		DeviceName string `json:"deviceName"`
+	}
+	_ = c.ShouldBindJSON(&input)
+
+	pollToken, err := services.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login request"})
+		return
+	}
+
+	match, err := randomTwoDigits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login request"})
+		return
+	}
+	choices, err := numberChoices(match)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login request"})
+		return
+	}
+
+	now := time.Now()
+	request := models.LoginRequest{
+		ID:            primitive.NewObjectID(),
+		PollTokenHash: services.HashToken(pollToken),
+		MatchNumber:   match,
+		NumberChoices: choices,
+		Status:        models.LoginRequestPending,
+		DeviceName:    input.DeviceName,
+		IP:            c.ClientIP(),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(loginRequestTTL),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := qc.LoginRequestCollection.InsertOne(ctx, request); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create login request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requestId":   request.ID.Hex(),
+		"qrPayload":   "egoty://qr-login?id=" + request.ID.Hex(),
+		"pollToken":   pollToken,
+		"matchNumber": request.MatchNumber,
+		"expiresAt":   request.ExpiresAt,
+	})
+}
+
+// GetLoginRequest shows the scanning device what it is about to approve. The
+// first signed-in user to open a request claims it; nobody else can see,
+// approve or deny it afterwards.
+func (qc *QRLoginController) GetLoginRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, qc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request models.LoginRequest
+	err = qc.LoginRequestCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":       requestID,
+			"status":    models.LoginRequestPending,
+			"expiresAt": bson.M{"$gt": time.Now()},
+			"$or":       bson.A{bson.M{"viewerId": bson.M{"$exists": false}}, bson.M{"viewerId": user.ID}},
+		},
+		bson.M{"$set": bson.M{"viewerId": user.ID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&request)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requestId":     request.ID.Hex(),
+		"deviceName":    request.DeviceName,
+		"ip":            request.IP,
+		"location":      services.LookupCountry(request.IP),
+		"createdAt":     request.CreatedAt,
+		"expiresAt":     request.ExpiresAt,
+		"numberChoices": request.NumberChoices,
+	})
+}
+
+// ApproveLoginRequest requires the user's PIN and the number shown on the new
+// device. The approving user also answers the factors that risk and their
+// sign_in policy ask for, since the new device can't.
+func (qc *QRLoginController) ApproveLoginRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request id"})
+		return
+	}
+
+	var input struct {
+		Pin         string `json:"pin"`
+		MatchNumber string `json:"matchNumber"`
+		Code        string `json:"code"`
+		TOTPCode    string `json:"totpCode"`
+		SMSCode     string `json:"smsCode"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Pin == "" || input.MatchNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pin and matchNumber are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, qc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if user.Pin == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PIN not registered"})
+		return
+	}
+	if !qc.checkApprovalPin(ctx, c, user, input.Pin) {
+		return
+	}
+
+	pending := bson.M{
+		"_id":       requestID,
+		"status":    models.LoginRequestPending,
+		"expiresAt": bson.M{"$gt": time.Now()},
+		"viewerId":  user.ID,
+	}
+
+	var request models.LoginRequest
+	if err := qc.LoginRequestCollection.FindOne(ctx, pending).Decode(&request); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found or expired"})
+		return
+	}
+
+	// A wrong pick kills the request so the number can't be guessed
+	if input.MatchNumber != request.MatchNumber {
+		_, _ = qc.LoginRequestCollection.UpdateOne(ctx, pending, bson.M{"$set": bson.M{"status": models.LoginRequestDenied}})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Number does not match, login request cancelled"})
+		return
+	}
+
+	attempt := qc.SignInFlow.assess(ctx, user, request.IP, "", false)
+	codes := map[string]string{
+		models.FactorEmail: input.Code,
+		models.FactorTOTP:  input.TOTPCode,
+		models.FactorSMS:   input.SMSCode,
+	}
+	if !qc.SignInFlow.requireFactors(ctx, c, user, &attempt, nil, nil, codes) {
+		return
+	}
+
+	result, err := qc.LoginRequestCollection.UpdateOne(ctx, pending, bson.M{"$set": bson.M{
+		"status":     models.LoginRequestApproved,
+		"approvedBy": user.ID,
+		"approvedAt": time.Now(),
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login approved"})
+}
+
+// DenyLoginRequest cancels a request the current user has scanned
+func (qc *QRLoginController) DenyLoginRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request id"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, qc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	result, err := qc.LoginRequestCollection.UpdateOne(ctx,
+		bson.M{"_id": requestID, "status": models.LoginRequestPending, "viewerId": user.ID},
+		bson.M{"$set": bson.M{"status": models.LoginRequestDenied}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found or expired"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Login denied"})
+}
+
+// checkApprovalPin compares the PIN, locking QR approvals for a while after
+// too many wrong ones. It answers the request itself when the PIN isn't accepted.
+func (qc *QRLoginController) checkApprovalPin(ctx context.Context, c *gin.Context, user models.User, pin string) bool {
+	if time.Now().Before(user.PinLockUntil) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many wrong PINs, try again later", "availableAt": user.PinLockUntil})
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Pin), []byte(pin)); err != nil {
+		var updated models.User
+		err := qc.UserCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$inc": bson.M{"pinFailures": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err == nil && updated.PinFailures >= maxPinFailures {
+			_, _ = qc.UserCollection.UpdateOne(ctx,
+				bson.M{"_id": user.ID},
+				bson.M{"$set": bson.M{"pinLockUntil": time.Now().Add(pinLockDuration)}, "$unset": bson.M{"pinFailures": ""}},
+			)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid PIN"})
+		return false
+	}
+
+	if user.PinFailures > 0 {
+		_, _ = qc.UserCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"pinFailures": ""}})
+	}
+	return true
+}
+
+// WaitLoginRequest long-polls until the request is approved, denied or expires.
+// On approval the new device receives its session exactly once.
+func (qc *QRLoginController) WaitLoginRequest(c *gin.Context) {
+	requestID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request id"})
+		return
+	}
+
+	pollToken := c.GetHeader("X-Poll-Token")
+	if pollToken == "" {
+		pollToken = c.Query("pollToken")
+	}
+	if pollToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pollToken is required"})
+		return
+	}
+
+	jkt, err := dpopBinding(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), loginPollTimeout)
+	defer cancel()
+
+	owned := bson.M{"_id": requestID, "pollTokenHash": services.HashToken(pollToken)}
+
+	for {
+		var request models.LoginRequest
+		err := qc.LoginRequestCollection.FindOne(ctx, owned).Decode(&request)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Login request not found"})
+			return
+		} else if err != nil && ctx.Err() == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if err == nil {
+			switch {
+			case request.Status == models.LoginRequestApproved:
+				qc.completeLoginRequest(c, request, jkt)
+				return
+			case request.Status == models.LoginRequestDenied, request.Status == models.LoginRequestCompleted:
+				c.JSON(http.StatusOK, gin.H{"status": request.Status})
+				return
+			case time.Now().After(request.ExpiresAt):
+				c.JSON(http.StatusOK, gin.H{"status": "expired"})
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			c.JSON(http.StatusOK, gin.H{"status": models.LoginRequestPending})
+			return
+		case <-time.After(loginPollInterval):
+		}
+	}
+}
+
+func (qc *QRLoginController) completeLoginRequest(c *gin.Context, request models.LoginRequest, jkt string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Flip approved -> completed atomically so only one poll gets the session
+	result, err := qc.LoginRequestCollection.UpdateOne(ctx,
+		bson.M{"_id": request.ID, "status": models.LoginRequestApproved},
+		bson.M{"$set": bson.M{"status": models.LoginRequestCompleted}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Login request already used"})
+		return
+	}
+
+	var user models.User
+	if err := qc.UserCollection.FindOne(ctx, bson.M{"_id": request.ApprovedBy}).Decode(&user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
+	attempt := qc.SignInFlow.assess(ctx, user, request.IP, "", false)
+	// the user approved this device themselves a moment ago
+	attempt.NewDevice = false
+
+	deletionCancelled, ok := qc.SignInFlow.finish(ctx, c, &user, attempt)
+	if !ok {
+		return
+	}
+
+	tokenString, err := issueSession(c, user, sessionOptions{JKT: jkt})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attempt.respond(gin.H{
+		"status":            models.LoginRequestApproved,
+		"message":           "Sign in successful",
+		"token":             tokenString,
+		"user":              sessionUser(user),
+		"deletionCancelled": deletionCancelled,
+	}))
+}
@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// no 0/O or 1/I so codes survive being read out loud
+const referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const referralCodeLength = 8
+
+var (
+	errSponsorNotFound    = errors.New("sponsor code not recognised")
+	errSponsorUnavailable = errors.New("this sponsor can't invite new members right now")
+	errSponsorQuotaUsed   = errors.New("this sponsor has no invitations left")
+	errInviteRequired     = errors.New("registration is by invitation only, a sponsor code is required")
+)
+
+type ReferralController struct {
+	UserCollection     *mongo.Collection
+	ReferralCollection *mongo.Collection
+}
+
+// SetupReferralIndexes allows one referral per invitee and one owner per referral code
+func SetupReferralIndexes(referrals, users *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := referrals.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"inviteeId": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "sponsorId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		log.Println("Failed to create referral indexes:", err)
+	}
+
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"referralCode": 1},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"referralCode": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		log.Println("Failed to create referral code index:", err)
+	}
+}
+
+// referralQuota reads REFERRAL_QUOTA, the invitations each account may use;
+// 0 (the default) means unlimited. Cancelled referrals don't count.
+func referralQuota() int {
+	n, err := strconv.Atoi(os.Getenv("REFERRAL_QUOTA"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// inviteOnly reads REGISTRATION_INVITE_ONLY; when set, new accounts need a valid sponsor code
+func inviteOnly() bool {
+	on, _ := strconv.ParseBool(os.Getenv("REGISTRATION_INVITE_ONLY"))
+	return on
+}
+
+func newReferralCode() (string, error) {
+	code := make([]byte, referralCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(referralCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = referralCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// usedInvitations counts the sponsor's referrals that take up quota
+func usedInvitations(ctx context.Context, referrals *mongo.Collection, sponsorID primitive.ObjectID) (int64, error) {
+	return referrals.CountDocuments(ctx, bson.M{
+		"sponsorId": sponsorID,
+		"status":    bson.M{"$ne": models.ReferralCancelled},
+	})
+}
+
+// resolveSponsor finds the account behind a sponsor code, either its referral
+// code or its EID, and checks it can still invite
+func resolveSponsor(ctx context.Context, users, referrals *mongo.Collection, code string) (models.User, error) {
+	var sponsor models.User
+	code = strings.TrimSpace(code)
+
+	err := users.FindOne(ctx, bson.M{"referralCode": strings.ToUpper(code)}).Decode(&sponsor)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		eid, formatErr := services.CanonicalEID(code)
+		if formatErr != nil {
+			return sponsor, errSponsorNotFound
+		}
+		sponsor, err = services.FindUserByEID(ctx, users, eid)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return sponsor, errSponsorNotFound
+	} else if err != nil {
+		return sponsor, err
+	}
+
+	if sponsor.IsFrozen() || sponsor.IsPendingDeletion() {
+		return sponsor, errSponsorUnavailable
+	}
+
+	if quota := referralQuota(); quota > 0 {
+		used, err := usedInvitations(ctx, referrals, sponsor.ID)
+		if err != nil {
+			return sponsor, err
+		}
+		if used >= int64(quota) {
+			return sponsor, errSponsorQuotaUsed
+		}
+	}
+	return sponsor, nil
+}
+
+// recordReferral links a newly registered account to its sponsor. An account
+// only ever has one sponsor, so a second call is a no-op.
+func recordReferral(ctx context.Context, referrals *mongo.Collection, sponsor, invitee models.User, code string) error {
+	if sponsor.ID == invitee.ID {
+		return nil
+	}
+	_, err := referrals.InsertOne(ctx, models.Referral{
+		ID:        primitive.NewObjectID(),
+		SponsorID: sponsor.ID,
+		InviteeID: invitee.ID,
+		Code:      code,
+		Status:    models.ReferralPending,
+		CreatedAt: time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// activateReferral marks the user's referral active the first time they sign in
+func activateReferral(ctx context.Context, referrals *mongo.Collection, inviteeID primitive.ObjectID) {
+	_, err := referrals.UpdateOne(ctx,
+		bson.M{"inviteeId": inviteeID, "status": models.ReferralPending},
+		bson.M{"$set": bson.M{"status": models.ReferralActive, "activatedAt": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to activate referral: %v", err)
+	}
+}
+
+// maskEmail keeps the first letter and the domain: "j***@example.com"
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// maskName shows the first name and the last name's initial: "Jane D."
+func maskName(first, last string) string {
+	name := strings.TrimSpace(first)
+	if last = strings.TrimSpace(last); last != "" {
+		name += " " + string([]rune(last)[:1]) + "."
+	}
+	return name
+}
+
+// GetReferralCode returns the user's referral code, issuing one on first use,
+// along with how many invitations are left
+func (rc *ReferralController) GetReferralCode(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, rc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	for i := 0; user.ReferralCode == "" && i < 5; i++ {
+		code, err := newReferralCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate referral code"})
+			return
+		}
+
+		// only set it if no concurrent request got there first
+		_, err = rc.UserCollection.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "referralCode": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"referralCode": code}},
+		)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if err := rc.UserCollection.FindOne(ctx, bson.M{"_id": user.ID}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	if user.ReferralCode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate referral code"})
+		return
+	}
+
+	used, err := usedInvitations(ctx, rc.ReferralCollection, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response := gin.H{"code": user.ReferralCode, "eid": user.EID, "used": used}
+	if quota := referralQuota(); quota > 0 {
+		response["quota"] = quota
+		response["remaining"] = max(int64(quota)-used, 0)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListInvitees pages through the accounts the user referred, newest first.
+// Invitees are shown masked; sponsors don't get their full email or name.
+func (rc *ReferralController) ListInvitees(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, rc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	filter := bson.M{"sponsorId": user.ID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	total, err := rc.ReferralCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	cursor, err := rc.ReferralCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var referrals []models.Referral
+	if err := cursor.All(ctx, &referrals); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	inviteeIDs := make([]primitive.ObjectID, len(referrals))
+	for i, referral := range referrals {
+		inviteeIDs[i] = referral.InviteeID
+	}
+	invitees := map[primitive.ObjectID]models.User{}
+	if len(inviteeIDs) > 0 {
+		cursor, err := rc.UserCollection.Find(ctx, bson.M{"_id": bson.M{"$in": inviteeIDs}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		var users []models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		for _, u := range users {
+			invitees[u.ID] = u
+		}
+	}
+
+	items := make([]gin.H, 0, len(referrals))
+	for _, referral := range referrals {
+		item := gin.H{
+			"id":          referral.ID,
+			"status":      referral.Status,
+			"joinedAt":    referral.CreatedAt,
+			"activatedAt": referral.ActivatedAt,
+		}
+		if invitee, ok := invitees[referral.InviteeID]; ok {
+			item["name"] = maskName(invitee.FirstName, invitee.LastName)
+			item["email"] = maskEmail(invitee.Email)
+		} else {
+			item["name"] = "Deleted account"
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitees": items,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+	})
+}
+
+// ReferralStats counts the user's referrals by status
+func (rc *ReferralController) ReferralStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, rc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	cursor, err := rc.ReferralCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"sponsorId": user.ID}}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var groups []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	counts := gin.H{}
+	for _, status := range models.ReferralStatuses {
+		counts[status] = int64(0)
+	}
+	var total int64
+	for _, group := range groups {
+		counts[group.Status] = group.Count
+		total += group.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{"counts": counts, "total": total})
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// signInAttempt carries what we learned about a sign-in between scoring and recording it
+type signInAttempt struct {
+	IP         string
+	Country    string
+	DeviceID   string
+	NewCountry bool
+	NewDevice  bool
+	Risk       services.RiskAssessment
+
+	TOTPFallback bool     // high risk, but the account has no authenticator to ask for
+	Verified     []string // factors checked during this sign-in
+}
+
+// respond adds the risk outcome to a sign-in response or challenge
+func (a signInAttempt) respond(body gin.H) gin.H {
+	body["riskLevel"] = a.Risk.Level
+	if a.TOTPFallback {
+		body["totpFallback"] = true
+	}
+	return body
+}
+
+// SetupLoginEventIndexes keeps per-user history queries fast and drops events after 180 days
+func SetupLoginEventIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.M{"createdAt": 1}, Options: options.Index().SetExpireAfterSeconds(180 * 24 * 60 * 60)},
+	})
+	if err != nil {
+		log.Println("Failed to create login event indexes:", err)
+	}
+}
+
+// assess scores an attempt against the user's previous sign-ins.
+// provenDevice means the device proved itself with a trust token or a device
+// key signature; the client-supplied deviceID is only a hint for alerts.
+func (f *SignInFlow) assess(ctx context.Context, user models.User, ip, deviceID string, provenDevice bool) signInAttempt {
+	attempt := signInAttempt{
+		IP:       ip,
+		Country:  services.LookupCountry(ip),
+		DeviceID: deviceID,
+	}
+
+	signals := services.RiskSignals{
+		Country:     attempt.Country,
+		KnownDevice: provenDevice,
+	}
+
+	var last models.LoginEvent
+	err := f.LoginEventCollection.FindOne(ctx,
+		bson.M{"userId": user.ID, "success": true},
+		options.FindOne().SetSort(bson.M{"createdAt": -1}),
+	).Decode(&last)
+	if err == nil {
+		signals.HasHistory = true
+		signals.SinceLastLogin = time.Since(last.CreatedAt)
+	}
+
+	if attempt.Country != "" {
+		n, _ := f.LoginEventCollection.CountDocuments(ctx, bson.M{"userId": user.ID, "success": true, "country": attempt.Country})
+		signals.KnownCountry = n > 0
+	}
+
+	// anyone can send a deviceId, so a familiar one only spares the user a
+	// "new device" email; it never lowers the risk score
+	seenDevice := provenDevice
+	if !seenDevice && deviceID != "" {
+		n, _ := f.LoginEventCollection.CountDocuments(ctx, bson.M{"userId": user.ID, "success": true, "deviceId": deviceID})
+		seenDevice = n > 0
+	}
+
+	failures, _ := f.LoginEventCollection.CountDocuments(ctx, bson.M{
+		"userId":    user.ID,
+		"success":   false,
+		"createdAt": bson.M{"$gt": time.Now().Add(-time.Hour)},
+	})
+	signals.RecentFailures = int(failures)
+
+	attempt.NewCountry = signals.HasHistory && attempt.Country != "" && !signals.KnownCountry
+	attempt.NewDevice = signals.HasHistory && !seenDevice
+	attempt.Risk = services.ScoreSignIn(signals)
+	return attempt
+}
+
+func (f *SignInFlow) recordLoginEvent(ctx context.Context, user models.User, attempt signInAttempt, success bool, reason string) {
+	_, err := f.LoginEventCollection.InsertOne(ctx, models.LoginEvent{
+		UserID:    user.ID,
+		IP:        attempt.IP,
+		Country:   attempt.Country,
+		DeviceID:  attempt.DeviceID,
+		Success:   success,
+		Reason:    reason,
+		RiskScore: attempt.Risk.Score,
+		RiskLevel: attempt.Risk.Level,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to record login event: %v", err)
+	}
+}
+
+// sendNewSignInAlert emails the user when a sign-in comes from a new country or device
+func sendNewSignInAlert(user models.User, attempt signInAttempt) {
+	location := attempt.Country
+	if location == "" {
+		location = "an unknown location"
+	}
+
+	what := "a new device"
+	if attempt.NewCountry {
+		what = "a new country"
+	}
+
+	sendSecurityEmail(user,
+		"New sign-in to your account",
+		fmt.Sprintf("<h3>We noticed a sign-in from %s.</h3><p>Location: %s<br>IP address: %s<br>Time: %s</p><p>If this was you, you can ignore this email.</p>",
+			what, location, attempt.IP, time.Now().UTC().Format(time.RFC1123)),
+	)
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	killSwitchPurpose = "kill_switch"
+	killSwitchTTL     = 30 * 24 * time.Hour
+)
+
+// publicAPIURL is where links in emails point, e.g. https://api.example.com
+func publicAPIURL() string {
+	if base := os.Getenv("PUBLIC_API_URL"); base != "" {
+		return base
+	}
+	return "http://localhost:8080"
+}
+
+// killSwitchURL is the signed "this wasn't me, freeze my account" link for a user
+func killSwitchURL(user models.User) string {
+	token := services.SignToken(killSwitchPurpose, user.ID.Hex(), killSwitchTTL)
+	return publicAPIURL() + "/account/emergency-freeze?token=" + url.QueryEscape(token)
+}
+
+// sendSecurityEmail sends a security notification carrying the emergency freeze link.
+// Every email about sign-ins or credential changes should go through here.
+func sendSecurityEmail(user models.User, subject, body string) {
+	html := body + fmt.Sprintf(
+		`<hr><p><b>Wasn't you?</b> <a href="%s">Freeze my account now</a>. This signs out every device and stops all sign-ins until you unfreeze it.</p>`,
+		killSwitchURL(user),
+	)
+
+	if err := services.SendEmail(user.Email, subject, html); err != nil {
+		log.Printf("Failed to send security email %q: %v", subject, err)
+	}
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SecurityPolicyController struct {
+	UserCollection *mongo.Collection
+	CodeController *CodeController
+}
+
+// policyResponse lists every action with its required factors, plus which
+// factors the user can currently choose from
+func policyResponse(user models.User) gin.H {
+	actions := gin.H{}
+	for _, action := range models.PolicyActions {
+		factors := user.RequiredFactors(action)
+		if factors == nil {
+			factors = []string{}
+		}
+		actions[action] = factors
+	}
+
+	available := []string{}
+	for _, factor := range models.Factors {
+		if factorAvailable(user, factor) {
+			available = append(available, factor)
+		}
+	}
+
+	response := gin.H{"actions": actions, "availableFactors": available}
+	if user.SecurityPolicy != nil {
+		response["updatedAt"] = user.SecurityPolicy.UpdatedAt
+	}
+	return response
+}
+
+func (sc *SecurityPolicyController) GetSecurityPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, sc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policy": policyResponse(user)})
+}
+
+// UpdateSecurityPolicy replaces the factors for the given actions (others are
+// left alone). It needs step-up verification, since it can weaken protection.
+func (sc *SecurityPolicyController) UpdateSecurityPolicy(c *gin.Context) {
+	var input struct {
+		Actions  map[string][]string `json:"actions"`
+		Code     string              `json:"code"`
+		TOTPCode string              `json:"totpCode"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil || len(input.Actions) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "actions are required"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, sc.UserCollection)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	validAction := map[string]bool{}
+	for _, action := range models.PolicyActions {
+		validAction[action] = true
+	}
+
+	set := bson.M{"securityPolicy.updatedAt": time.Now()}
+	for action, factors := range input.Actions {
+		if !validAction[action] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown action " + action, "actions": models.PolicyActions})
+			return
+		}
+
+		seen := map[string]bool{}
+		cleaned := []string{}
+		for _, factor := range factors {
+			factor = strings.ToLower(strings.TrimSpace(factor))
+			if seen[factor] {
+				continue
+			}
+			if !factorAvailable(user, factor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Factor %q isn't available for this account", factor), "availableFactors": policyResponse(user)["availableFactors"]})
+				return
+			}
+			seen[factor] = true
+			cleaned = append(cleaned, factor)
+		}
+		set["securityPolicy.actions."+action] = cleaned
+	}
+
+	if err := sc.CodeController.verifyStepUp(ctx, user, input.Code, input.TOTPCode); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = sc.UserCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security policy"})
+		return
+	}
+
+	go sendSecurityEmail(user, "Your security settings changed",
+		"<h3>The verification methods protecting your account were just changed.</h3><p>If you did this, no action is needed.</p>")
+
+	c.JSON(http.StatusOK, gin.H{"policy": policyResponse(user)})
+}
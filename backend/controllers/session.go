@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type sessionOptions struct {
+	RememberMe bool
+	JKT        string    // thumbprint of the DPoP key the token is bound to, if any
+	ProfileID  string    // profile the token is scoped to; empty means the default profile
+	ExpiresAt  time.Time // overrides the RememberMe expiry, used when re-issuing a live session
+}
+
+// dpopBinding validates an optional DPoP header on a token-issuing request
+// and returns the key thumbprint to bind the new token to
+func dpopBinding(c *gin.Context) (string, error) {
+	proof := c.GetHeader("DPoP")
+	if proof == "" {
+		return "", nil
+	}
+	return services.VerifyDPoPProof(c.Request.Context(), proof, c.Request.Method, services.DPoPRequestURL(c.Request), "")
+}
+
+// issueSession signs a JWT for the user and sets it as the token cookie
+func issueSession(c *gin.Context, user models.User, opts sessionOptions) (string, error) {
+	expirationTime := time.Now().Add(24 * time.Hour)
+	if opts.RememberMe {
+		expirationTime = time.Now().Add(15 * 24 * time.Hour)
+	}
+	if !opts.ExpiresAt.IsZero() {
+		expirationTime = opts.ExpiresAt
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": fmt.Sprintf("%v", user.ID),
+		"eid":     user.EID,
+		"email":   user.Email,
+		"exp":     expirationTime.Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	if opts.JKT != "" {
+		claims["cnf"] = map[string]string{"jkt": opts.JKT}
+	}
+	if opts.ProfileID != "" {
+		claims["profile_id"] = opts.ProfileID
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	secret := os.Getenv("JWT_SECRET")
+	tokenString, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	c.SetCookie("token", tokenString, int(time.Until(expirationTime).Seconds()), "/", "", false, true)
+	return tokenString, nil
+}
+
+// sessionUser is the user summary returned with every new session
+func sessionUser(user models.User) gin.H {
+	return gin.H{
+		"id":                user.ID,
+		"eid":               user.EID,
+		"email":             user.Email,
+		"firstName":         user.FirstName,
+		"lastName":          user.LastName,
+		"pinRegistered":     user.Pin != "",
+		"patternRegistered": user.PatternHash != "",
+	}
+}
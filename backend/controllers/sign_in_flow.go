@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SignInFlow is what every way of signing in shares once the user has shown
+// who they are: risk scoring, the extra factors that risk and the user's
+// security policy ask for, login history, new sign-in alerts and referral
+// activation.
+type SignInFlow struct {
+	UserCollection       *mongo.Collection
+	LoginEventCollection *mongo.Collection
+	ReferralCollection   *mongo.Collection
+	CodeController       *CodeController
+}
+
+// requireFactors checks every factor the sign-in still needs: those the
+// method asks for itself, TOTP when the risk is high (or the email code when
+// the account has no authenticator) and those the sign_in policy lists.
+// proven are the factors the method has already verified. It answers 401
+// naming the first missing or wrong factor and returns false.
+func (f *SignInFlow) requireFactors(ctx context.Context, c *gin.Context, user models.User, attempt *signInAttempt, needed, proven []string, codes map[string]string) bool {
+	required := slices.Clone(needed)
+	if attempt.Risk.Level == services.RiskHigh {
+		if factorAvailable(user, models.FactorTOTP) {
+			required = append(required, models.FactorTOTP)
+		} else {
+			attempt.TOTPFallback = true
+			required = append(required, models.FactorEmail)
+		}
+	}
+	required = append(required, user.RequiredFactors(models.ActionSignIn)...)
+
+	attempt.Verified = slices.Clone(proven)
+	for _, factor := range models.Factors {
+		if !slices.Contains(required, factor) || slices.Contains(proven, factor) {
+			continue
+		}
+		if err := f.CodeController.checkFactor(ctx, user, factor, codes[factor], models.CodePurposeSignIn); err != nil {
+			if codes[factor] != "" {
+				f.recordLoginEvent(ctx, user, *attempt, false, factor)
+			}
+			body := gin.H{"error": err.Error(), "challenge": factorChallenge(factor), "requiredFactors": required}
+			if factor == models.FactorEmail {
+				body["codeRequired"] = true
+			}
+			c.JSON(http.StatusUnauthorized, attempt.respond(body))
+			return false
+		}
+		attempt.Verified = append(attempt.Verified, factor)
+	}
+	return true
+}
+
+// factorChallenge is the challenge name clients already switch on
+func factorChallenge(factor string) string {
+	if factor == models.FactorEmail {
+		return "email_code"
+	}
+	return factor
+}
+
+// finish records the successful sign-in, alerts the user about a new country
+// or device, activates their referral and restores an account pending
+// deletion. It answers 500 and returns false if the account couldn't be restored.
+func (f *SignInFlow) finish(ctx context.Context, c *gin.Context, user *models.User, attempt signInAttempt) (deletionCancelled bool, ok bool) {
+	f.recordLoginEvent(ctx, *user, attempt, true, "")
+	if attempt.NewCountry || attempt.NewDevice {
+		go sendNewSignInAlert(*user, attempt)
+	}
+
+	activateReferral(ctx, f.ReferralCollection, user.ID)
+
+	deletionCancelled, err := cancelPendingDeletion(ctx, f.UserCollection, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return false, false
+	}
+	return deletionCancelled, true
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+)
+
+// Step-up verification: sensitive actions need a fresh email code sent for
+// step-up and, when the user has an authenticator set up, a TOTP code as well.
+
+var (
+	errStepUpCodeRequired = errors.New("verification code is required")
+	errStepUpCodeInvalid  = errors.New("invalid or expired verification code")
+	errStepUpTOTPRequired = errors.New("authenticator code is required")
+	errStepUpTOTPInvalid  = errors.New("invalid authenticator code")
+)
+
+func (cc *CodeController) verifyStepUp(ctx context.Context, user models.User, code, totpCode string) error {
+	return cc.verifyStepUpFor(ctx, user, models.CodePurposeStepUp, code, totpCode)
+}
+
+// verifyStepUpFor is verifyStepUp with an email code sent for purpose
+func (cc *CodeController) verifyStepUpFor(ctx context.Context, user models.User, purpose, code, totpCode string) error {
+	if code == "" {
+		return errStepUpCodeRequired
+	}
+	if user.TwoFASecret != "" && totpCode == "" {
+		return errStepUpTOTPRequired
+	}
+
+	// the code is only used up once the authenticator code checks out too
+	if err := cc.verifyPurposeCode(ctx, user, purpose, code, false); err != nil {
+		return errStepUpCodeInvalid
+	}
+
+	if user.TwoFASecret != "" && !services.VerifyTOTP(user.TwoFASecret, totpCode) {
+		return errStepUpTOTPInvalid
+	}
+
+	if err := cc.verifyPurposeCode(ctx, user, purpose, code, true); err != nil {
+		return errStepUpCodeInvalid
+	}
+	return nil
+}
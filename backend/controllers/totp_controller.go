@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"flutter_project_backend/models"
 	"flutter_project_backend/services"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -46,16 +48,24 @@ func (tc *TOTPController) GenerateTOTP(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = tc.UserCollection.UpdateOne(ctx,
+	var user models.User
+	err = tc.UserCollection.FindOneAndUpdate(ctx,
 		bson.M{"email": req.Email},
 		bson.M{"$set": bson.M{"twofa_secret": secret}},
-	)
+	).Decode(&user)
 
-	if err != nil {
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
 		return
 	}
 
+	if err == nil {
+		go sendSecurityEmail(user,
+			"Two-factor authentication changed",
+			fmt.Sprintf("<h3>A new authenticator app was set up for your account on %s.</h3><p>Codes from any previous authenticator no longer work.</p>", time.Now().UTC().Format(time.RFC1123)),
+		)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"secret": secret, "qrUrl": qrUrl})
 }
 
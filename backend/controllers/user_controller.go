@@ -176,17 +176,18 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"flutter_project_backend/models"
+	"flutter_project_backend/services"
 	"flutter_project_backend/utils"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/pquerna/otp/totp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -195,8 +196,16 @@ import (
 )
 
 type UserController struct {
-	UserCollection *mongo.Collection
-	CodeController *CodeController
+	UserCollection     *mongo.Collection
+	SignInFlow         *SignInFlow
+	ProfileCollection  *mongo.Collection
+	CountryCollection  *mongo.Collection
+	LanguageCollection *mongo.Collection
+	ReferralCollection *mongo.Collection
+	CodeController     *CodeController
+	DeviceController   *DeviceController
+	EIDAllocator       *services.EIDAllocator
+	PowVerifier        *services.PowVerifier
 }
 
 // Send verification code
@@ -219,6 +228,11 @@ func (uc *UserController) SendCode(c *gin.Context) {
 	code := ""
 	now := time.Now()
 
+	if err == nil && user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
+	}
+
 	if err == nil {
 		// User exists
 		if now.Sub(user.EmailCodeSent) < 15*time.Minute {
@@ -243,7 +257,6 @@ func (uc *UserController) SendCode(c *gin.Context) {
 	}
 
 	// TODO: integrate email service
-	fmt.Println("Verification code:", code)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Code sent"})
 }
@@ -274,13 +287,28 @@ func (uc *UserController) Register(c *gin.Context) {
 		return
 	}
 
-	// Normalize email
-	email := strings.TrimSpace(strings.ToLower(input.Email))
+	// Screen the email the same way GetCode did; a client can post here directly
+	validateCtx, cancelValidate := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelValidate()
+	email, err := uc.CodeController.EmailValidator.Validate(validateCtx, input.Email)
+	if err != nil {
+		respondEmailError(c, err)
+		return
+	}
+
+	// Gender is stored lowercase, as PATCH /me stores it
+	gender := ""
+	if input.Gender != "" {
+		if gender, err = services.NormalizeGender(input.Gender); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Gender " + err.Error()})
+			return
+		}
+	}
 
-	// Parse DOB
-	dob, err := time.Parse("2006-01-02", input.DateOfBirth)
+	// Parse DOB and apply the age rules
+	dob, err := services.ParseDateOfBirth(input.DateOfBirth)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Date of birth " + err.Error()})
 		return
 	}
 
@@ -298,12 +326,11 @@ func (uc *UserController) Register(c *gin.Context) {
 	var eid string
 	if err == mongo.ErrNoDocuments {
 		// New user — generate new EID
-		eid, err = utils.GenerateEID()
+		eid, err = uc.generateEID(context.TODO())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate EID"})
 			return
 		}
-		eid = strings.ToLower(eid)
 		// eid = strings.ToLower(utils.GenerateEID())
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -311,12 +338,11 @@ func (uc *UserController) Register(c *gin.Context) {
 	} else {
 		// Existing user — check if they have an EID
 		if existing.EID == "" {
-			eid, err = utils.GenerateEID()
+			eid, err = uc.generateEID(context.TODO())
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate EID"})
 				return
 			}
-			eid = strings.ToLower(eid)
 			// No EID exists, generate one
 			// eid = strings.ToLower(utils.GenerateEID())
 		} else {
@@ -325,13 +351,39 @@ func (uc *UserController) Register(c *gin.Context) {
 		}
 	}
 
+	// --- SPONSOR CODE ---
+	// only checked for accounts being created; finishing a half-done
+	// registration doesn't change who referred it
+	newAccount := existing.Password == ""
+	sponsorCode := strings.TrimSpace(input.SponsorCode)
+	var sponsor models.User
+	if newAccount && sponsorCode != "" {
+		sponsor, err = resolveSponsor(context.TODO(), uc.UserCollection, uc.ReferralCollection, sponsorCode)
+		if errors.Is(err, errSponsorNotFound) || errors.Is(err, errSponsorUnavailable) || errors.Is(err, errSponsorQuotaUsed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "sponsorCode"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if sponsor.Email == email {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You can't sponsor yourself", "field": "sponsorCode"})
+			return
+		}
+	} else if newAccount && inviteOnly() {
+		c.JSON(http.StatusForbidden, gin.H{"error": errInviteRequired.Error(), "field": "sponsorCode"})
+		return
+	} else if !newAccount {
+		sponsorCode = existing.SponsorCode
+	}
+
 	// Prepare update / insert
 	update := bson.M{
 		"$set": bson.M{
 			"firstName":   input.FirstName,
 			"lastName":    input.LastName,
-			"sponsorCode": input.SponsorCode,
-			"gender":      input.Gender,
+			"sponsorCode": sponsorCode,
+			"gender":      gender,
 			"country":     input.Country,
 			"language":    input.Language,
 			"dob":         dob,
@@ -342,23 +394,47 @@ func (uc *UserController) Register(c *gin.Context) {
 		},
 	}
 
-	_, err = uc.UserCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"email": email},
-		update,
-		options.Update().SetUpsert(true),
-	)
+	var registered models.User
+	for attempt := 0; ; attempt++ {
+		err = uc.UserCollection.FindOneAndUpdate(
+			context.TODO(),
+			bson.M{"email": email},
+			update,
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&registered)
+
+		// another registration took the same EID first; only retry with a fresh one
+		if !mongo.IsDuplicateKeyError(err) || eid == strings.ToLower(existing.EID) || attempt == 2 {
+			break
+		}
+		eid, err = uc.generateEID(context.TODO())
+		if err != nil {
+			break
+		}
+		update["$set"].(bson.M)["eid"] = eid
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
 	}
 
+	if !sponsor.ID.IsZero() {
+		if err := recordReferral(context.TODO(), uc.ReferralCollection, sponsor, registered, sponsorCode); err != nil {
+			log.Printf("Warning: Failed to record referral: %v", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Registration successful",
 		"eid":     eid,
 	})
 }
 
+// generateEID allocates a new lowercase EID that no account holds or has retired
+func (uc *UserController) generateEID(ctx context.Context) (string, error) {
+	return uc.EIDAllocator.Allocate(ctx)
+}
+
 // Migration function - Run this ONCE to add EIDs to existing users
 func (uc *UserController) MigrateUsersEID(c *gin.Context) {
 	// Use bson.M to avoid decoding issues with mismatched types
@@ -368,8 +444,7 @@ func (uc *UserController) MigrateUsersEID(c *gin.Context) {
 		return
 	}
 
-	fmt.Println("\n=== MIGRATION START ===")
-	fmt.Println("Checking all users:")
+	log.Println("EID migration: checking all users")
 
 	type UserIDEmail struct {
 		ID    interface{} `bson:"_id"`
@@ -381,52 +456,46 @@ func (uc *UserController) MigrateUsersEID(c *gin.Context) {
 	for cursor.Next(context.TODO()) {
 		var user UserIDEmail
 		if err := cursor.Decode(&user); err != nil {
-			fmt.Printf("Error decoding user: %v\n", err)
+			log.Printf("EID migration: error decoding user: %v", err)
 			continue
 		}
 
-		fmt.Printf("User: %s, EID: '%s', EID Length: %d\n", user.Email, user.EID, len(user.EID))
-
 		// Check if EID is empty or missing
 		if user.EID == "" {
 			usersToUpdate = append(usersToUpdate, user)
-			fmt.Printf("  -> Will update this user (empty EID)\n")
 		}
 	}
 	cursor.Close(context.TODO())
 
-	fmt.Printf("\nFound %d users that need EID\n", len(usersToUpdate))
+	log.Printf("EID migration: %d users need an EID", len(usersToUpdate))
 
 	// Now update them
 	updated := 0
 	for _, user := range usersToUpdate {
-		eid, err := utils.GenerateEID()
+		newEID, err := uc.generateEID(context.TODO())
 		if err != nil {
-			fmt.Printf("Error generating EID for user %s: %v\n", user.Email, err)
+			log.Printf("EID migration: error generating EID for user %v: %v", user.ID, err)
 			continue
 		}
 
-		newEID := strings.ToLower(eid)
-
 		result, err := uc.UserCollection.UpdateOne(
 			context.TODO(),
 			bson.M{"_id": user.ID},
 			bson.M{"$set": bson.M{"eid": newEID}},
 		)
 		if err != nil {
-			fmt.Printf("Error updating user %s: %v\n", user.Email, err)
+			log.Printf("EID migration: error updating user %v: %v", user.ID, err)
 			continue
 		}
 
 		if result.ModifiedCount > 0 {
 			updated++
-			fmt.Printf("✓ Updated user %s with EID: %s\n", user.Email, newEID)
 		} else {
-			fmt.Printf("✗ Failed to update user %s (no rows modified)\n", user.Email)
+			log.Printf("EID migration: user %v was not updated", user.ID)
 		}
 	}
 
-	fmt.Println("=== MIGRATION END ===\n")
+	log.Printf("EID migration: updated %d of %d users", updated, len(usersToUpdate))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "Migration completed",
@@ -439,10 +508,16 @@ func (uc *UserController) MigrateUsersEID(c *gin.Context) {
 
 func (uc *UserController) SignIn(c *gin.Context) {
 	var input struct {
-		Identifier string `json:"identifier"` // EID or Email
-		Password   string `json:"password"`
-		Code       string `json:"code"` // verification code
-		RememberMe bool   `json:"rememberMe"`
+		Identifier  string `json:"identifier"` // EID or Email
+		Password    string `json:"password"`
+		Code        string `json:"code"` // verification code
+		RememberMe  bool   `json:"rememberMe"`
+		DeviceToken string `json:"deviceToken"` // issued by a previous sign-in with trustDevice
+		TrustDevice bool   `json:"trustDevice"`
+		DeviceName  string `json:"deviceName"`
+		DeviceID    string `json:"deviceId"` // stable per-install id used for new-device detection
+		TOTPCode    string `json:"totpCode"` // required for high-risk sign-ins
+		SMSCode     string `json:"smsCode"`  // required when the security policy asks for SMS
 	}
 
 	if err := c.BindJSON(&input); err != nil {
@@ -450,91 +525,104 @@ func (uc *UserController) SignIn(c *gin.Context) {
 		return
 	}
 
-	if input.Identifier == "" || input.Password == "" || input.Code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "EID/Email, password, and code are required"})
+	if input.Identifier == "" || input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "EID/Email and password are required"})
+		return
+	}
+
+	// --- OPTIONAL DPoP KEY BINDING ---
+	jkt, err := dpopBinding(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
 	ctx := context.TODO()
-	var user models.User
-	var email string
+	start := time.Now()
 
-	// --- Resolve identifier to email ---
-	if strings.Contains(input.Identifier, "@") {
-		email = strings.TrimSpace(strings.ToLower(input.Identifier))
-		err := uc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Email not registered"})
-			return
-		}
-	} else {
-		err := uc.UserCollection.FindOne(ctx, bson.M{"eid": input.Identifier}).Decode(&user)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid EID"})
-			return
-		}
-		email = user.Email
+	// --- Resolve identifier (email, EID, phone or @handle) ---
+	user, err := findUserByIdentifier(ctx, uc.UserCollection, input.Identifier)
+	if hideUnknownAccount(err) {
+		burnPasswordCheck(input.Password)
+		credentialsRejected(c, start, genericCredentialsMessage)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": identifierError(err)})
+		return
 	}
 
+	// --- RISK ASSESSMENT ---
+	trusted := uc.DeviceController.IsTrusted(ctx, user, input.DeviceToken)
+	attempt := uc.SignInFlow.assess(ctx, user, c.ClientIP(), input.DeviceID, trusted)
+
 	// --- PASSWORD VERIFICATION ---
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		uc.SignInFlow.recordLoginEvent(ctx, user, attempt, false, "password")
+		credentialsRejected(c, start, "Invalid password")
 		return
 	}
 
-	filter := bson.M{
-		"email":    email,
-		"code":     input.Code,
-		"isActive": true,
+	// --- FROZEN ACCOUNTS CAN'T SIGN IN ---
+	if user.IsFrozen() {
+		c.JSON(http.StatusForbidden, frozenResponse)
+		return
 	}
 
-	var codeDoc models.EmailCode
-	err := uc.CodeController.EmailCodeCollection.FindOne(ctx, filter).Decode(&codeDoc)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired verification code"})
-		return
+	// --- CHALLENGES ---
+	// The email code is the minimum; only a device proven by its trust token
+	// skips it, and not when the risk is high. High risk also needs TOTP, or
+	// the email code alone for accounts without an authenticator, which every
+	// response then flags with totpFallback. The security policy adds the rest.
+	var needed []string
+	if !trusted || attempt.Risk.Level == services.RiskHigh {
+		needed = []string{models.FactorEmail}
 	}
-	// --- DELETE USED CODE ---
-	_, err = uc.CodeController.EmailCodeCollection.DeleteOne(ctx, bson.M{"_id": codeDoc.ID})
-	if err != nil {
-		log.Printf("Warning: Failed to delete used code: %v", err)
+	codes := map[string]string{
+		models.FactorEmail: input.Code,
+		models.FactorTOTP:  input.TOTPCode,
+		models.FactorSMS:   input.SMSCode,
+	}
+	if !uc.SignInFlow.requireFactors(ctx, c, user, &attempt, needed, nil, codes) {
+		return
 	}
 
-	// --- GENERATE JWT ---
-	expirationTime := time.Now().Add(24 * time.Hour)
-	if input.RememberMe {
-		expirationTime = time.Now().Add(15 * 24 * time.Hour)
+	// --- REMEMBER DEVICE (only after a code-verified sign-in) ---
+	deviceToken := ""
+	if slices.Contains(attempt.Verified, models.FactorEmail) && !trusted && input.TrustDevice {
+		token, err := uc.DeviceController.IssueTrustToken(ctx, user, input.DeviceName, c.ClientIP())
+		if err != nil {
+			log.Printf("Warning: Failed to trust device: %v", err)
+		} else {
+			deviceToken = token
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": fmt.Sprintf("%v", user.ID),
-		"eid":     user.EID,
-		"email":   user.Email,
-		"exp":     expirationTime.Unix(),
-	})
+	// --- SIGNING IN CANCELS A PENDING DELETION ---
+	deletionCancelled, ok := uc.SignInFlow.finish(ctx, c, &user, attempt)
+	if !ok {
+		return
+	}
 
-	secret := os.Getenv("JWT_SECRET")
-	tokenString, err := token.SignedString([]byte(secret))
+	// --- GENERATE JWT ---
+	tokenString, err := issueSession(c, user, sessionOptions{RememberMe: input.RememberMe, JKT: jkt})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.SetCookie("token", tokenString, int(expirationTime.Sub(time.Now()).Seconds()), "/", "", false, true)
-
-	c.JSON(http.StatusOK, gin.H{
+	response := attempt.respond(gin.H{
 		"message": "Sign in successful",
 		"token":   tokenString,
-		"user": gin.H{
-			"id":                user.ID,
-			"eid":               user.EID,
-			"email":             user.Email,
-			"firstName":         user.FirstName,
-			"lastName":          user.LastName,
-			"pinRegistered":     user.Pin != "",
-			"patternRegistered": user.PatternHash != "",
-		},
+		"user":    sessionUser(user),
 	})
+	if deviceToken != "" {
+		response["deviceToken"] = deviceToken
+	}
+	if deletionCancelled {
+		response["deletionCancelled"] = true
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // func (uc *UserController) SignIn(c *gin.Context) {
@@ -747,21 +835,13 @@ func (uc *UserController) ValidateCredentials(c *gin.Context) {
 	}
 
 	ctx := context.TODO()
-	var user models.User
-	var err error
-
-	// Resolve identifier (email or EID)
-	if strings.Contains(input.Identifier, "@") {
-		err = uc.UserCollection.FindOne(ctx, bson.M{
-			"email": strings.TrimSpace(strings.ToLower(input.Identifier)),
-		}).Decode(&user)
-	} else {
-		err = uc.UserCollection.FindOne(ctx, bson.M{
-			"eid": input.Identifier,
-		}).Decode(&user)
-	}
 
+	// Resolve identifier (email, EID, phone or @handle)
+	user, err := findUserByIdentifier(ctx, uc.UserCollection, input.Identifier)
 	if err != nil {
+		if enumerationProtection() {
+			burnPasswordCheck(input.Password)
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"valid": false})
 		return
 	}
@@ -850,26 +930,36 @@ func (uc *UserController) RegisterPin(c *gin.Context) {
 		return
 	}
 
-	if len(input.Pin) != 4 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "PIN must be 4 digits"})
+	if err := services.ValidateNewPin(input.Pin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	email, exists := c.Get("email")
-	if !exists {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
+	// Replacing a PIN goes through /change-pin, which needs the current one
+	if user.Pin != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "PIN already registered, use change PIN instead"})
+		return
+	}
+
 	hashedPin, err := bcrypt.GenerateFromPassword([]byte(input.Pin), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
 		return
 	}
 
-	_, err = uc.UserCollection.UpdateOne(
-		c,
-		bson.M{"email": email},
+	// the filter guards against a concurrent registration
+	result, err := uc.UserCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.ID, "pin": bson.M{"$in": []interface{}{nil, ""}}},
 		bson.M{"$set": bson.M{"pin": string(hashedPin)}},
 	)
 
@@ -877,6 +967,13 @@ func (uc *UserController) RegisterPin(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register PIN"})
 		return
 	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "PIN already registered, use change PIN instead"})
+		return
+	}
+
+	go sendSecurityEmail(user, "A PIN was added to your account",
+		"<h3>A PIN was just set up for your account.</h3><p>If you did this, no action is needed.</p>")
 
 	c.JSON(http.StatusOK, gin.H{"message": "PIN registered successfully"})
 }
@@ -892,8 +989,8 @@ func (uc *UserController) ValidatePin(c *gin.Context) {
 		return
 	}
 
-	if len(input.Pin) != 4 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "PIN must be 4 digits"})
+	if input.Pin == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PIN is required"})
 		return
 	}
 
@@ -933,42 +1030,36 @@ func (uc *UserController) RegisterPattern(c *gin.Context) {
 		return
 	}
 
-	// Validate pattern length
-	if len(input.Pattern) < 4 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Pattern must have at least 4 dots"})
+	// Validate length, grid geometry and complexity
+	if err := services.ValidateNewPattern(input.Pattern); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get email from context (middleware should set this)
-	emailRaw, exists := c.Get("email")
-	if !exists {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Get the user from the token (middleware sets the email)
+	user, err := currentUser(ctx, c, uc.UserCollection)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	email, ok := emailRaw.(string)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid email in context"})
-		return
-	}
 
-	// Convert pattern to string like "1-2-3-4"
-	dotStrings := make([]string, len(input.Pattern))
-	for i, dot := range input.Pattern {
-		dotStrings[i] = fmt.Sprintf("%d", dot+1) // +1 if Flutter indexes start from 0
+	// Replacing a pattern goes through /change-pattern, which needs the current one
+	if user.PatternHash != "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Pattern already registered, use change pattern instead"})
+		return
 	}
-	patternStr := strings.Join(dotStrings, "-")
 
 	// Hash pattern
-	hashedPattern, err := bcrypt.GenerateFromPassword([]byte(patternStr), bcrypt.DefaultCost)
+	hashedPattern, err := bcrypt.GenerateFromPassword([]byte(patternString(input.Pattern)), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash pattern"})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{"email": email}
+	filter := bson.M{"_id": user.ID, "patternHash": bson.M{"$in": []interface{}{nil, ""}}}
 	update := bson.M{"$set": bson.M{"patternHash": string(hashedPattern)}}
 
 	result, err := uc.UserCollection.UpdateOne(ctx, filter, update)
@@ -978,10 +1069,13 @@ func (uc *UserController) RegisterPattern(c *gin.Context) {
 	}
 
 	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		c.JSON(http.StatusConflict, gin.H{"error": "Pattern already registered, use change pattern instead"})
 		return
 	}
 
+	go sendSecurityEmail(user, "An unlock pattern was added to your account",
+		"<h3>An unlock pattern was just set up for your account.</h3><p>If you did this, no action is needed.</p>")
+
 	c.JSON(http.StatusOK, gin.H{"message": "Pattern registered successfully"})
 }
 
@@ -1010,11 +1104,7 @@ func (uc *UserController) ValidatePattern(c *gin.Context) {
 	email := emailRaw.(string)
 
 	// Convert pattern to a string like "1-5-9-8"
-	dotStrings := make([]string, len(input.Pattern))
-	for i, dot := range input.Pattern {
-		dotStrings[i] = fmt.Sprintf("%d", dot+1)
-	}
-	patternStr := strings.Join(dotStrings, "-")
+	patternStr := patternString(input.Pattern)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -1053,6 +1143,10 @@ func (uc *UserController) ResetPassword(c *gin.Context) {
 		NewPassword     string `json:"newPassword"`
 		ConfirmPassword string `json:"confirmPassword"`
 		Method          string `json:"method"` // "email" or "auth"
+		// extra codes for factors the security policy requires beyond the method
+		EmailCode string `json:"emailCode"`
+		TOTPCode  string `json:"totpCode"`
+		SMSCode   string `json:"smsCode"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1068,24 +1162,20 @@ func (uc *UserController) ResetPassword(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Resolve user
-	var user models.User
-	var email string
-	if strings.Contains(req.Identifier, "@") {
-		email = strings.TrimSpace(strings.ToLower(req.Identifier))
-		if err := uc.UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email not registered"})
-			return
-		}
-	} else {
-		if err := uc.UserCollection.FindOne(ctx, bson.M{"eid": req.Identifier}).Decode(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid EID"})
-			return
-		}
-		email = user.Email
+	// Resolve user (email, EID, phone or @handle)
+	user, err := findUserByIdentifier(ctx, uc.UserCollection, req.Identifier)
+	if hideUnknownAccount(err) {
+		dummyCodeLookup(uc.CodeController.VerificationCodeCollection)
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidCodeMessage})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": identifierError(err)})
+		return
 	}
+	email := user.Email
 
 	// Verify code
+	var methodFactor string
 	switch strings.ToLower(req.Method) {
 	case "auth":
 		if user.TwoFASecret == "" {
@@ -1096,36 +1186,37 @@ func (uc *UserController) ResetPassword(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticator code"})
 			return
 		}
+		methodFactor = models.FactorTOTP
 
 	case "email":
-		var codeDoc models.EmailCode
-		err := uc.CodeController.EmailCodeCollection.FindOne(ctx, bson.M{
-			"email":    email,
-			"code":     req.Code,
-			"isActive": true,
-		}).Decode(&codeDoc)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired code"})
-			return
-		}
-
-		// Expiry check
-		if time.Since(codeDoc.SentAt) > 5*time.Minute {
-			_, _ = uc.CodeController.EmailCodeCollection.DeleteOne(ctx, bson.M{"_id": codeDoc.ID})
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Code expired"})
+		if err := uc.CodeController.verifyPurposeCode(ctx, user, models.CodePurposePasswordReset, req.Code, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalidCodeMessage})
 			return
 		}
-
-		// ✅ Defer deactivation/deletion until after password reset
-		defer func() {
-			_, _ = uc.CodeController.EmailCodeCollection.DeleteOne(ctx, bson.M{"_id": codeDoc.ID})
-		}()
+		methodFactor = models.FactorEmail
 
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid method"})
 		return
 	}
 
+	// Security policy: every other required factor needs its own code
+	policy := user.RequiredFactors(models.ActionPasswordReset)
+	codes := map[string]string{
+		models.FactorEmail: req.EmailCode,
+		models.FactorTOTP:  req.TOTPCode,
+		models.FactorSMS:   req.SMSCode,
+	}
+	for _, factor := range policy {
+		if factor == methodFactor {
+			continue
+		}
+		if err := uc.CodeController.checkFactor(ctx, user, factor, codes[factor], models.CodePurposePasswordReset); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "challenge": factor, "requiredFactors": policy})
+			return
+		}
+	}
+
 	// Hash password
 	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -1143,6 +1234,11 @@ func (uc *UserController) ResetPassword(c *gin.Context) {
 		return
 	}
 
+	go sendSecurityEmail(user,
+		"Your password was changed",
+		fmt.Sprintf("<h3>The password for your account was reset on %s.</h3><p>If you did this, no action is needed.</p>", time.Now().UTC().Format(time.RFC1123)),
+	)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password reset successful"})
 }
 
@@ -1156,10 +1252,19 @@ func (uc *UserController) CheckEID(c *gin.Context) {
 		return
 	}
 
-	eid := strings.ToLower(strings.TrimSpace(input.EID))
+	eid, err := services.CanonicalEID(input.EID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "available": false})
+		return
+	}
 
-	var user models.User
-	err := uc.UserCollection.FindOne(context.TODO(), bson.M{"eid": eid}).Decode(&user)
+	// the answer reveals whether an account exists, so besides the per-IP
+	// rate limit it costs a proof of work when enumeration protection is on
+	if enumerationProtection() && !requirePow(c, uc.PowVerifier, powScopeCheckEID) {
+		return
+	}
+
+	_, err = services.FindUserByEID(context.TODO(), uc.UserCollection, eid)
 	if err == mongo.ErrNoDocuments {
 		// EID does NOT exist → available
 		c.JSON(http.StatusOK, gin.H{"available": true})
@@ -1174,7 +1279,9 @@ func (uc *UserController) CheckEID(c *gin.Context) {
 }
 
 func (uc *UserController) SetCurrency(c *gin.Context) {
-	eid, exists := c.Get("eid") // get eid from AuthMiddleware
+	// tokens issued before EIDs gained a check character still carry the old
+	// form, so the account is found by email rather than EID
+	email, exists := c.Get("email")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
@@ -1189,20 +1296,36 @@ func (uc *UserController) SetCurrency(c *gin.Context) {
 		return
 	}
 
-	// Use EID to update
-	filter := bson.M{"eid": eid.(string)}
 	update := bson.M{"$set": bson.M{"currencyCode": body.CurrencyCode}}
 
-	result, err := uc.UserCollection.UpdateOne(context.TODO(), filter, update)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	// A session scoped to a secondary profile only changes that profile
+	if profileID, ok := currentProfileID(c); ok {
+		var profile models.Profile
+		err := uc.ProfileCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": profileID}, update).Decode(&profile)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+			return
+		}
+		if !profile.IsDefault {
+			c.JSON(http.StatusOK, gin.H{"message": "Currency updated"})
+			return
+		}
 	}
 
-	if result.MatchedCount == 0 {
+	filter := bson.M{"email": email.(string)}
+
+	var user models.User
+	err := uc.UserCollection.FindOneAndUpdate(context.TODO(), filter, update).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
+	// the default profile mirrors the account's own preferences
+	_, _ = uc.ProfileCollection.UpdateOne(context.TODO(), bson.M{"userId": user.ID, "isDefault": true}, update)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Currency updated"})
 }
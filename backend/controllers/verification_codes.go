@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
+	"flutter_project_backend/utils"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Emailed codes for accounts (see models.VerificationCode). Each is bound to
+// the purpose it was sent for, stored hashed, good for verificationCodeTTL and
+// dead after verificationCodeMaxAttempts wrong guesses.
+
+const (
+	verificationCodeTTL         = 10 * time.Minute
+	verificationCodeMaxAttempts = 5
+)
+
+// SetupVerificationCodeIndexes keeps one code per account and purpose. Documents
+// stay a day after the last send so the resend cooldown keeps counting.
+func SetupVerificationCodeIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.M{"sentAt": 1}, Options: options.Index().SetExpireAfterSeconds(int32((24 * time.Hour).Seconds()))},
+	})
+	if err != nil {
+		log.Println("Failed to create verification code indexes:", err)
+	}
+}
+
+// sendPurposeCode emails the user a new code for purpose, formatted into body.
+// While the last one is still cooling down it sends nothing and returns the
+// time left. It returns how many codes have been sent and the cooldown.
+func (cc *CodeController) sendPurposeCode(ctx context.Context, user models.User, purpose, subject, body string) (int, time.Duration, error) {
+	filter := bson.M{"userId": user.ID, "purpose": purpose}
+
+	var last models.VerificationCode
+	err := cc.VerificationCodeCollection.FindOne(ctx, filter).Decode(&last)
+	if err == nil {
+		if remaining := remainingCooldown(last.SentAt, last.Sends-1); remaining > 0 && last.CodeHash != "" {
+			return last.Sends, remaining, nil
+		}
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, 0, err
+	}
+
+	code := utils.GenerateCode(6)
+	now := time.Now()
+
+	var updated models.VerificationCode
+	err = cc.VerificationCodeCollection.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{
+			"$set": bson.M{
+				"codeHash":  services.HashToken(code),
+				"attempts":  0,
+				"sentAt":    now,
+				"expiresAt": now.Add(verificationCodeTTL),
+			},
+			"$inc":         bson.M{"sends": 1},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := services.SendEmail(user.Email, subject, fmt.Sprintf(body, code)); err != nil {
+		return 0, 0, err
+	}
+
+	return updated.Sends, getCooldown(updated.Sends - 1), nil
+}
+
+// verifyPurposeCode checks a code sent for purpose. A wrong guess counts against
+// the code; with consume a right one is used up.
+func (cc *CodeController) verifyPurposeCode(ctx context.Context, user models.User, purpose, code string, consume bool) error {
+	if code == "" {
+		return errFactorCodeRequired
+	}
+
+	var sent models.VerificationCode
+	err := cc.VerificationCodeCollection.FindOne(ctx, bson.M{
+		"userId":    user.ID,
+		"purpose":   purpose,
+		"codeHash":  bson.M{"$exists": true},
+		"expiresAt": bson.M{"$gt": time.Now()},
+		"attempts":  bson.M{"$lt": verificationCodeMaxAttempts},
+	}).Decode(&sent)
+	if err != nil {
+		return errFactorCodeInvalid
+	}
+
+	if services.HashToken(code) != sent.CodeHash {
+		_, _ = cc.VerificationCodeCollection.UpdateOne(ctx, bson.M{"_id": sent.ID}, bson.M{"$inc": bson.M{"attempts": 1}})
+		return errFactorCodeInvalid
+	}
+	if !consume {
+		return nil
+	}
+
+	// only one request gets to use the code
+	result, err := cc.VerificationCodeCollection.UpdateOne(ctx,
+		bson.M{"_id": sent.ID, "codeHash": sent.CodeHash},
+		bson.M{"$unset": bson.M{"codeHash": ""}},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return errFactorCodeInvalid
+	}
+	return nil
+}
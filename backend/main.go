@@ -13,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
 	"flutter_project_backend/routes"
 	"flutter_project_backend/seed"
 	"flutter_project_backend/services"
@@ -45,11 +46,56 @@ func main() {
 	languageCollection := db.Collection("languages")
 	countryCollection := db.Collection("countries")
 	emailCodeCollection := db.Collection("email_codes")
+	trustedDeviceCollection := db.Collection("trusted_devices")
+	loginEventCollection := db.Collection("login_events")
+	deviceKeyCollection := db.Collection("device_keys")
+	deviceChallengeCollection := db.Collection("device_challenges")
+	loginRequestCollection := db.Collection("login_requests")
+	dpopProofCollection := db.Collection("dpop_proofs")
+	magicLinkCollection := db.Collection("magic_links")
+	dataExportCollection := db.Collection("data_exports")
+	profileCollection := db.Collection("profiles")
+	emailChangeCollection := db.Collection("email_changes")
+	smsCodeCollection := db.Collection("sms_codes")
+	verificationCodeCollection := db.Collection("verification_codes")
+	referralCollection := db.Collection("referrals")
+	powRedeemedCollection := db.Collection("pow_redeemed")
 
 	// controllers.SetupEmailCodeTTL(emailCodeCollection)
 
 	// go controllers.CleanupExpiredCodes(emailCodeCollection)
 
+	controllers.SetupTrustedDeviceIndexes(trustedDeviceCollection)
+	controllers.SetupLoginEventIndexes(loginEventCollection)
+	controllers.SetupDeviceKeyIndexes(deviceKeyCollection, deviceChallengeCollection)
+	controllers.SetupLoginRequestIndexes(loginRequestCollection)
+	services.InitDPoPReplayStore(dpopProofCollection)
+	controllers.SetupMagicLinkIndexes(magicLinkCollection)
+	controllers.SetupDataExportIndexes(dataExportCollection)
+	controllers.SetupProfileIndexes(profileCollection)
+	controllers.SetupEmailChangeIndexes(emailChangeCollection)
+	controllers.SetupSMSCodeIndexes(smsCodeCollection)
+	controllers.SetupVerificationCodeIndexes(verificationCodeCollection)
+	controllers.SetupReferralIndexes(referralCollection, userCollection)
+	services.SetupEIDIndexes(userCollection, db.Collection("eid_pool"))
+	controllers.SetupHandleIndexes(userCollection)
+	controllers.SetupPhoneIndexes(userCollection)
+	services.SetupPowIndexes(powRedeemedCollection)
+
+	// adds the check character to EIDs issued before it existed, before any
+	// request can look one up; lookups still fall back to accounts it skips
+	if migrated, err := services.MigrateEIDFormat(db); err != nil {
+		log.Println("EID format migration failed:", err)
+	} else if migrated > 0 {
+		log.Printf("Migrated %d EIDs to the checked format", migrated)
+	}
+
+	services.StartAccountPurge(db, time.Hour)
+
+	if err := services.InitGeoIP(os.Getenv("GEOIP_DB_PATH")); err != nil {
+		log.Println("Failed to open GeoIP database:", err)
+	}
+
 	if err := seed.SeedLanguages(languageCollection); err != nil {
 		log.Fatal("Failed to seed languages:", err)
 	}
@@ -66,18 +112,117 @@ func main() {
 		log.Println("Error updating currency prices:", err)
 	}
 
+	middleware.UserCollection = userCollection
+	middleware.ProfileCollection = profileCollection
+	middleware.Limiter = services.NewRateLimiter(db)
+
 	r := gin.Default()
+	if err := middleware.ConfigureClientIP(r); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "DPoP", "X-PoW-Challenge", "X-PoW-Solution"},
+		ExposeHeaders:    []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 	}))
+	r.Use(middleware.RateLimit())
+
+	powVerifier := &services.PowVerifier{Used: &services.MongoPowRedemptions{Collection: powRedeemedCollection}}
 
 	codeController := &controllers.CodeController{
-		EmailCodeCollection: emailCodeCollection,
+		EmailCodeCollection:        emailCodeCollection,
+		VerificationCodeCollection: verificationCodeCollection,
+		SMSCodeCollection:          smsCodeCollection,
+		UserCollection:             userCollection,
+		PowVerifier:                powVerifier,
+		EmailValidator:             services.NewEmailValidator(),
+	}
+
+	signInFlow := &controllers.SignInFlow{
+		UserCollection:       userCollection,
+		LoginEventCollection: loginEventCollection,
+		ReferralCollection:   referralCollection,
+		CodeController:       codeController,
+	}
+
+	deviceController := &controllers.DeviceController{
+		UserCollection:            userCollection,
+		TrustedDeviceCollection:   trustedDeviceCollection,
+		DeviceKeyCollection:       deviceKeyCollection,
+		DeviceChallengeCollection: deviceChallengeCollection,
+		SignInFlow:                signInFlow,
+	}
+
+	eidAllocator := services.NewEIDAllocator(db)
+	eidAllocator.Start(5 * time.Minute)
+
+	userController := &controllers.UserController{
+		UserCollection:     userCollection,
+		SignInFlow:         signInFlow,
+		ProfileCollection:  profileCollection,
+		CountryCollection:  countryCollection,
+		LanguageCollection: languageCollection,
+		ReferralCollection: referralCollection,
+		CodeController:     codeController,
+		DeviceController:   deviceController,
+		EIDAllocator:       eidAllocator,
+		PowVerifier:        powVerifier,
+	}
+
+	qrLoginController := &controllers.QRLoginController{
+		UserCollection:         userCollection,
+		LoginRequestCollection: loginRequestCollection,
+		SignInFlow:             signInFlow,
+	}
+
+	magicLinkController := &controllers.MagicLinkController{
 		UserCollection:      userCollection,
+		MagicLinkCollection: magicLinkCollection,
+		SignInFlow:          signInFlow,
+		PowVerifier:         powVerifier,
+	}
+
+	accountController := &controllers.AccountController{
+		UserCollection:            userCollection,
+		TrustedDeviceCollection:   trustedDeviceCollection,
+		DeviceKeyCollection:       deviceKeyCollection,
+		DeviceChallengeCollection: deviceChallengeCollection,
+		MagicLinkCollection:       magicLinkCollection,
+		LoginRequestCollection:    loginRequestCollection,
+		CodeController:            codeController,
+	}
+
+	profileController := &controllers.ProfileController{
+		UserCollection:     userCollection,
+		ProfileCollection:  profileCollection,
+		LanguageCollection: languageCollection,
+	}
+
+	emailChangeController := &controllers.EmailChangeController{
+		UserCollection:             userCollection,
+		EmailChangeCollection:      emailChangeCollection,
+		EmailCodeCollection:        emailCodeCollection,
+		VerificationCodeCollection: verificationCodeCollection,
+	}
+	controllers.StartEmailChangeApplier(emailChangeController, 10*time.Minute)
+
+	referralController := &controllers.ReferralController{
+		UserCollection:     userCollection,
+		ReferralCollection: referralCollection,
+	}
+
+	securityPolicyController := &controllers.SecurityPolicyController{
+		UserCollection: userCollection,
+		CodeController: codeController,
+	}
+
+	dataExportController := &controllers.DataExportController{
+		UserCollection:       userCollection,
+		DataExportCollection: dataExportCollection,
+		Database:             db,
 	}
 
 	totpController := &controllers.TOTPController{
@@ -92,7 +237,19 @@ func main() {
 	routes.CountryRoutes(r, countryCollection)
 	routes.CodeRoutes(r, codeController)
 	routes.TOTPRoutes(r, totpController)
-	routes.UserRoutes(r, userCollection, codeController)
+	routes.UserRoutes(r, userController)
+	routes.DeviceRoutes(r, deviceController)
+	routes.DeviceKeyRoutes(r, deviceController)
+	routes.QRLoginRoutes(r, qrLoginController)
+	routes.MagicLinkRoutes(r, magicLinkController)
+	routes.AccountRoutes(r, accountController)
+	routes.DataExportRoutes(r, dataExportController)
+	routes.ProfileRoutes(r, profileController)
+	routes.EmailChangeRoutes(r, emailChangeController)
+	routes.SecurityPolicyRoutes(r, securityPolicyController)
+	routes.ReferralRoutes(r, referralController)
+	routes.HealthRoutes(r, &controllers.HealthController{EIDAllocator: eidAllocator})
+	routes.PowRoutes(r, &controllers.PowController{})
 	routes.CurrencyRoutes(r, currencyController)
 
 	r.GET("/", func(c *gin.Context) {
@@ -1,16 +1,31 @@
 package middleware
 
 import (
+	"context"
+	"flutter_project_backend/models"
+	"flutter_project_backend/services"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// AuthMiddleware checks JWT in header or cookie
+// UserCollection is set from main so the middleware can check account status
+var UserCollection *mongo.Collection
+
+// ProfileCollection is set from main so tokens scoped to a deleted profile stop working
+var ProfileCollection *mongo.Collection
+
+// AuthMiddleware checks JWT in header or cookie.
+// Tokens bound to a key (cnf.jkt) also need a fresh DPoP proof signed by that key.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var tokenString string
@@ -18,6 +33,8 @@ func AuthMiddleware() gin.HandlerFunc {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
 			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+		} else if authHeader != "" && strings.HasPrefix(authHeader, "DPoP ") {
+			tokenString = strings.TrimPrefix(authHeader, "DPoP ")
 		} else {
 			cookie, err := c.Cookie("token")
 			if err == nil {
@@ -52,9 +69,85 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		jkt := ""
+		if cnf, ok := claims["cnf"].(map[string]interface{}); ok {
+			jkt, _ = cnf["jkt"].(string)
+			proof := c.GetHeader("DPoP")
+			if proof == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing DPoP proof"})
+				c.Abort()
+				return
+			}
+
+			thumbprint, err := services.VerifyDPoPProof(c.Request.Context(), proof, c.Request.Method, services.DPoPRequestURL(c.Request), tokenString)
+			if err != nil || thumbprint != jkt {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid DPoP proof"})
+				c.Abort()
+				return
+			}
+		}
+
+		if UserCollection != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var account struct {
+				ID              primitive.ObjectID `bson:"_id"`
+				Status          string             `bson:"status"`
+				SessionsRevoked time.Time          `bson:"sessionsRevokedAt"`
+			}
+			err := UserCollection.FindOne(ctx,
+				bson.M{"email": claims["email"]},
+				options.FindOne().SetProjection(bson.M{"_id": 1, "status": 1, "sessionsRevokedAt": 1}),
+			).Decode(&account)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+			if !account.SessionsRevoked.IsZero() {
+				iat, _ := claims["iat"].(float64)
+				if int64(iat) < account.SessionsRevoked.Unix() {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+					c.Abort()
+					return
+				}
+			}
+			if account.Status == models.AccountStatusFrozen {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Account is frozen", "frozen": true})
+				c.Abort()
+				return
+			}
+
+			if profileHex, ok := claims["profile_id"].(string); ok && ProfileCollection != nil {
+				profileID, err := primitive.ObjectIDFromHex(profileHex)
+				if err == nil {
+					err = ProfileCollection.FindOne(ctx, bson.M{"_id": profileID, "userId": account.ID}).Err()
+				}
+				if err != nil {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Profile no longer exists"})
+					c.Abort()
+					return
+				}
+			}
+		}
+
 		c.Set("email", claims["email"].(string))
 		c.Set("user_id", claims["user_id"].(string))
 		c.Set("eid", claims["eid"].(string))
+		if profileID, ok := claims["profile_id"].(string); ok {
+			c.Set("profile_id", profileID)
+		}
+		if jkt != "" {
+			c.Set("jkt", jkt)
+		}
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			c.Set("session_exp", exp.Time)
+		}
+
+		if !applyRateLimits(c, services.RateLimitByUser) {
+			return
+		}
 
 		c.Next()
 	}
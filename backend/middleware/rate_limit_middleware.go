@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flutter_project_backend/services"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limiter is set from main; with no limiter nothing is rate limited
+var Limiter *services.RateLimiter
+
+// ConfigureClientIP decides whose X-Forwarded-For c.ClientIP() believes. The
+// ip buckets, risk scoring and proof-of-work difficulty all key on it, so by
+// default no proxy is trusted and it's the connecting address.
+// TRUSTED_PROXIES lists proxy IPs or CIDRs, comma-separated; TRUSTED_PLATFORM
+// names a CDN whose client IP header to use ("cloudflare", "google" or the
+// header itself), which is only safe when every request comes through it.
+// DPoP proofs also trust X-Forwarded-Proto and X-Forwarded-Host from the
+// listed proxies only.
+func ConfigureClientIP(r *gin.Engine) error {
+	switch platform := strings.TrimSpace(os.Getenv("TRUSTED_PLATFORM")); strings.ToLower(platform) {
+	case "":
+	case "cloudflare":
+		r.TrustedPlatform = gin.PlatformCloudflare
+	case "google":
+		r.TrustedPlatform = gin.PlatformGoogleAppEngine
+	default:
+		r.TrustedPlatform = platform
+	}
+
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		return err
+	}
+	return services.TrustForwardedHeadersFrom(proxies)
+}
+
+// RateLimit applies the configured per-IP and per-identifier rules for the
+// matched route. Per-user rules need the user ID, so AuthMiddleware applies
+// those once the token checks out.
+func RateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !applyRateLimits(c, services.RateLimitByIP, services.RateLimitByIdentifier) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// applyRateLimits takes a token from every bucket of the given kinds for this
+// route. It answers 429 and returns false if any bucket is empty. The
+// RateLimit-* headers describe whichever bucket is closest to running out.
+func applyRateLimits(c *gin.Context, kinds ...string) bool {
+	if Limiter == nil {
+		return true
+	}
+	route := c.Request.Method + " " + c.FullPath()
+	rules := Limiter.Rules[route]
+	if len(rules) == 0 {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var (
+		identifier     string
+		identifierRead bool
+		tightest       *services.RateLimitResult
+		tightestRule   services.RateLimitRule
+	)
+
+	for _, rule := range rules {
+		if !slices.Contains(kinds, rule.Key) {
+			continue
+		}
+
+		var subject string
+		switch rule.Key {
+		case services.RateLimitByIP:
+			subject = c.ClientIP()
+		case services.RateLimitByIdentifier:
+			if !identifierRead {
+				identifier = bodyIdentifier(c)
+				identifierRead = true
+			}
+			subject = identifier
+		case services.RateLimitByUser:
+			subject = c.GetString("user_id")
+		}
+		if subject == "" {
+			continue
+		}
+
+		result, err := Limiter.Take(ctx, route, rule, subject)
+		if err != nil {
+			// a store outage shouldn't take sign-in down with it
+			log.Println("Rate limit check failed:", err)
+			continue
+		}
+		if tightest == nil ||
+			(tightest.Allowed && !result.Allowed) ||
+			(tightest.Allowed == result.Allowed && result.Remaining < tightest.Remaining) {
+			tightest, tightestRule = &result, rule
+		}
+	}
+
+	if tightest == nil {
+		return true
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(tightestRule.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.Reset)))
+
+	if !tightest.Allowed {
+		retryAfter := ceilSeconds(tightest.RetryAfter)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		// clients that keep hitting limits get harder proof-of-work challenges
+		services.FlagSuspiciousIP(c.ClientIP())
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later", "retryAfter": retryAfter})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// bodyIdentifier reads the email, EID or identifier field of a JSON body and
+// puts the body back for the handler. Spellings of the same account share a bucket.
+func bodyIdentifier(c *gin.Context) string {
+	if c.Request.Body == nil || !strings.Contains(c.ContentType(), "json") {
+		return ""
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		Identifier string `json:"identifier"`
+		Email      string `json:"email"`
+		EID        string `json:"eid"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+
+	for _, raw := range []string{fields.Identifier, fields.Email, fields.EID} {
+		if raw == "" {
+			continue
+		}
+		if id, err := services.ClassifyIdentifier(raw); err == nil {
+			return id.Kind + ":" + id.Value
+		}
+		return strings.ToLower(strings.TrimSpace(raw))
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func clientIPFor(t *testing.T, header, value string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	if err := ConfigureClientIP(r); err != nil {
+		t.Fatalf("ConfigureClientIP: %v", err)
+	}
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	req.Header.Set(header, value)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestConfigureClientIPIgnoresForwardedForByDefault(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	t.Setenv("TRUSTED_PLATFORM", "")
+
+	if ip := clientIPFor(t, "X-Forwarded-For", "203.0.113.9"); ip != "10.0.0.7" {
+		t.Fatalf("ClientIP = %s, want the connecting address 10.0.0.7", ip)
+	}
+}
+
+func TestConfigureClientIPTrustsListedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.1, 10.0.0.0/8")
+	t.Setenv("TRUSTED_PLATFORM", "")
+
+	if ip := clientIPFor(t, "X-Forwarded-For", "203.0.113.9"); ip != "203.0.113.9" {
+		t.Fatalf("ClientIP = %s, want the forwarded 203.0.113.9", ip)
+	}
+}
+
+func TestConfigureClientIPPlatform(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	t.Setenv("TRUSTED_PLATFORM", "cloudflare")
+
+	if ip := clientIPFor(t, "CF-Connecting-IP", "198.51.100.4"); ip != "198.51.100.4" {
+		t.Fatalf("ClientIP = %s, want Cloudflare's 198.51.100.4", ip)
+	}
+}
+
+func TestConfigureClientIPRejectsBadProxy(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+
+	if err := ConfigureClientIP(gin.New()); err == nil {
+		t.Fatal("ConfigureClientIP accepted an invalid proxy")
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Account status values for User.Status; the zero value means active
+const (
+	AccountStatusActive          = ""
+	AccountStatusFrozen          = "frozen"
+	AccountStatusPendingDeletion = "pending_deletion"
+)
+
+// Freeze reason codes, matching the choices on the app's freeze screen
+const (
+	FreezeReasonNotUsing  = "not_using"
+	FreezeReasonSecurity  = "security_concerns"
+	FreezeReasonTraveling = "traveling_abroad"
+	FreezeReasonFinancial = "financial_reasons"
+	FreezeReasonOther     = "other"
+)
+
+var FreezeReasons = []string{
+	FreezeReasonNotUsing,
+	FreezeReasonSecurity,
+	FreezeReasonTraveling,
+	FreezeReasonFinancial,
+	FreezeReasonOther,
+}
+
+// Who froze an account
+const (
+	FrozenBySelf       = "self"
+	FrozenByKillSwitch = "kill_switch" // "this wasn't me" link in a security email
+)
+
+type AccountFreeze struct {
+	Reason   string    `bson:"reason" json:"reason"`
+	Note     string    `bson:"note,omitempty" json:"note,omitempty"`
+	FrozenAt time.Time `bson:"frozenAt" json:"frozenAt"`
+	FrozenBy string    `bson:"frozenBy" json:"frozenBy"`
+
+	UnfreezeFailures int       `bson:"unfreezeFailures,omitempty" json:"-"` // wrong passwords or codes when unfreezing
+	LockedUntil      time.Time `bson:"lockedUntil,omitempty" json:"-"`      // unfreezing is refused until then
+}
+
+// AccountDeletion is set while an account waits out its deletion grace period
+type AccountDeletion struct {
+	Reason      string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	RequestedAt time.Time `bson:"requestedAt" json:"requestedAt"`
+	PurgeAt     time.Time `bson:"purgeAt" json:"purgeAt"`
+}
+
+// RetiredEID keeps the EID of a purged account so it is never handed out again
+type RetiredEID struct {
+	EID       string    `bson:"_id"`
+	RetiredAt time.Time `bson:"retiredAt"`
+}
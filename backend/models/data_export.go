@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a personal data export (GDPR access request). The ZIP is kept on
+// the document until it expires.
+type DataExport struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"-"`
+	Status      string             `bson:"status" json:"status"`
+	Archive     []byte             `bson:"archive,omitempty" json:"-"`
+	Size        int                `bson:"size,omitempty" json:"size,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	CompletedAt time.Time          `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DeviceKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"-"`
+	DeviceID   string             `bson:"deviceId" json:"deviceId"`
+	Name       string             `bson:"name" json:"name"`
+	Algorithm  string             `bson:"algorithm" json:"algorithm"` // "ed25519" or "p256"
+	PublicKey  string             `bson:"publicKey" json:"-"`         // base64 PKIX (SubjectPublicKeyInfo) DER
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt time.Time          `bson:"lastUsedAt,omitempty" json:"lastUsedAt"`
+}
+
+type DeviceKeyChallenge struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	KeyID     primitive.ObjectID `bson:"keyId"`
+	Challenge string             `bson:"challenge"`
+	Used      bool               `bson:"used"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
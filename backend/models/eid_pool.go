@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ReservedEID is an upstream EID fetched ahead of time, waiting for a new account
+type ReservedEID struct {
+	EID       string    `bson:"_id" json:"eid"`
+	FetchedAt time.Time `bson:"fetchedAt" json:"fetchedAt"`
+}
+
+// EIDPoolStats is the health view of the EID allocator
+type EIDPoolStats struct {
+	Depth        int64     `json:"depth"`
+	Target       int       `json:"target"`
+	Upstream     string    `json:"upstream,omitempty"`
+	LastRefillAt time.Time `json:"lastRefillAt,omitempty"`
+	LastError    string    `json:"lastError,omitempty"`
+	LocalIssued  int64     `json:"localIssued"` // EIDs made by the fallback generator since startup
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	EmailChangePending   = "pending"   // waiting for the code sent to the new address
+	EmailChangeConfirmed = "confirmed" // waiting out the cooling-off period
+	EmailChangeApplied   = "applied"
+	EmailChangeCancelled = "cancelled"
+	EmailChangeFailed    = "failed" // new address was taken before the change applied
+)
+
+// EmailChange is a request to move an account to a new email address
+type EmailChange struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"-"`
+	OldEmail    string             `bson:"oldEmail" json:"oldEmail"`
+	NewEmail    string             `bson:"newEmail" json:"newEmail"`
+	CodeHash    string             `bson:"codeHash" json:"-"`
+	Attempts    int                `bson:"attempts" json:"-"`
+	Status      string             `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	ConfirmedAt time.Time          `bson:"confirmedAt,omitempty" json:"confirmedAt,omitempty"`
+	ApplyAt     time.Time          `bson:"applyAt,omitempty" json:"applyAt,omitempty"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"` // the code expires; once confirmed, the record is kept for history
+}
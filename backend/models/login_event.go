@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LoginEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	IP        string             `bson:"ip" json:"ip"`
+	Country   string             `bson:"country,omitempty" json:"country,omitempty"`
+	DeviceID  string             `bson:"deviceId,omitempty" json:"deviceId,omitempty"`
+	Success   bool               `bson:"success" json:"success"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"` // why a failed attempt failed
+	RiskScore int                `bson:"riskScore" json:"riskScore"`
+	RiskLevel string             `bson:"riskLevel" json:"riskLevel"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	LoginRequestPending   = "pending"
+	LoginRequestApproved  = "approved"
+	LoginRequestDenied    = "denied"
+	LoginRequestCompleted = "completed"
+)
+
+// LoginRequest is a cross-device (QR) sign-in waiting for approval from a signed-in device
+type LoginRequest struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	PollTokenHash string             `bson:"pollTokenHash"`
+	MatchNumber   string             `bson:"matchNumber"` // shown on the new device, picked on the approving one
+	NumberChoices []string           `bson:"numberChoices"`
+	Status        string             `bson:"status"`
+	DeviceName    string             `bson:"deviceName"`
+	IP            string             `bson:"ip"`
+	ViewerID      primitive.ObjectID `bson:"viewerId,omitempty"` // the signed-in user who scanned it; only they can approve or deny
+	ApprovedBy    primitive.ObjectID `bson:"approvedBy,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt"`
+	ApprovedAt    time.Time          `bson:"approvedAt,omitempty"`
+	ExpiresAt     time.Time          `bson:"expiresAt"`
+}
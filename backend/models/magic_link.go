@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MagicLink struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	UserID          primitive.ObjectID `bson:"userId"`
+	TokenHash       string             `bson:"tokenHash"`
+	DeviceNonceHash string             `bson:"deviceNonceHash"` // the link only works with the nonce held by the requesting device
+	IP              string             `bson:"ip"`
+	CreatedAt       time.Time          `bson:"createdAt"`
+	ExpiresAt       time.Time          `bson:"expiresAt"`
+	UsedAt          *time.Time         `bson:"usedAt,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Profile is one of the personas under an account. Every account has a default
+// profile; tokens scoped to a profile carry its id in the profile_id claim.
+type Profile struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"userId" json:"-"`
+	DisplayName  string             `bson:"displayName" json:"displayName"`
+	CurrencyCode string             `bson:"currencyCode,omitempty" json:"currencyCode,omitempty"`
+	LanguageID   string             `bson:"languageId,omitempty" json:"languageId,omitempty"` // _id in the languages collection
+	Pin          string             `bson:"pin,omitempty" json:"-"`                           // hashed, asked for when switching to this profile
+	IsDefault    bool               `bson:"isDefault" json:"isDefault"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ReferralPending   = "pending"   // invitee registered but hasn't signed in yet
+	ReferralActive    = "active"    // invitee has signed in
+	ReferralCancelled = "cancelled" // invitee's account was deleted
+)
+
+var ReferralStatuses = []string{ReferralPending, ReferralActive, ReferralCancelled}
+
+// Referral records who brought an account in and with which code
+type Referral struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SponsorID   primitive.ObjectID `bson:"sponsorId" json:"-"`
+	InviteeID   primitive.ObjectID `bson:"inviteeId" json:"-"`
+	Code        string             `bson:"code" json:"code"` // the sponsor's EID or referral code, as matched
+	Status      string             `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	ActivatedAt time.Time          `bson:"activatedAt,omitempty" json:"activatedAt,omitempty"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Verification factors a user can require, matching the app's protect access screen
+const (
+	FactorTOTP  = "totp"  // authenticator app
+	FactorEmail = "email" // emailed code
+	FactorSMS   = "sms"   // texted code
+)
+
+var Factors = []string{FactorTOTP, FactorEmail, FactorSMS}
+
+// Action categories a security policy can guard
+const (
+	ActionSignIn         = "sign_in"
+	ActionPasswordReset  = "password_reset"
+	ActionCurrencyChange = "currency_change"
+	ActionFreeze         = "freeze"
+	ActionSendFunds      = "send_funds"
+)
+
+var PolicyActions = []string{ActionSignIn, ActionPasswordReset, ActionCurrencyChange, ActionFreeze, ActionSendFunds}
+
+// SecurityPolicy maps an action to the factors that must all be verified for it.
+// These come on top of what a flow already asks for (risk-based sign-in challenges,
+// the reset code); an action that isn't listed needs nothing extra.
+type SecurityPolicy struct {
+	Actions   map[string][]string `bson:"actions" json:"actions"`
+	UpdatedAt time.Time           `bson:"updatedAt" json:"updatedAt"`
+}
+
+// SMSCodeEnrollPhone marks a code that confirms a phone number being added
+const SMSCodeEnrollPhone = "enroll_phone"
+
+// SMSCode is a one-time code texted to the user's phone
+type SMSCode struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Purpose   string             `bson:"purpose,omitempty"` // empty for the SMS factor
+	Phone     string             `bson:"phone,omitempty"`   // the number being enrolled
+	CodeHash  string             `bson:"codeHash"`
+	Attempts  int                `bson:"attempts"`
+	SentAt    time.Time          `bson:"sentAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
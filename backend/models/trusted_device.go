@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TrustedDevice struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"-"`
+	Name       string             `bson:"name" json:"name"`
+	TokenHash  string             `bson:"tokenHash" json:"-"` // sha256 of the issued token
+	IP         string             `bson:"ip" json:"ip"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt time.Time          `bson:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
@@ -15,6 +15,7 @@ type User struct {
 	EmailCodeSent    time.Time          `bson:"emailCodeSent"`
 	Password         string             `bson:"password"` // hashed
 	SponsorCode      string             `bson:"sponsorCode"`
+	ReferralCode     string             `bson:"referralCode,omitempty" json:"-"` // issued the first time the user asks for it
 	Gender           string             `bson:"gender"`
 	Country          Country            `bson:"country"`  // ✅ Changed from string to Country
 	Language         Language           `bson:"language"` // ✅ Changed from string to Language
@@ -25,8 +26,34 @@ type User struct {
 	LastFailedAt     time.Time          `bson:"lastFailedAt,omitempty" json:"lastFailedAt"`
 	AccountLockUntil time.Time          `bson:"accountLockUntil,omitempty" json:"accountLockUntil"`
 	Pin              string             `bson:"pin,omitempty" json:"pin,omitempty"`
+	PinFailures      int                `bson:"pinFailures,omitempty" json:"-"`  // wrong PINs when approving a QR login
+	PinLockUntil     time.Time          `bson:"pinLockUntil,omitempty" json:"-"` // set after too many of them
 	PatternHash      string             `bson:"patternHash,omitempty" json:"patternHash,omitempty"`
-	Phone            string             `bson:"phone,omitempty" json:"phone,omitempty"`
+	Phone            string             `bson:"phone,omitempty" json:"phone,omitempty"`   // E.164
+	Handle           string             `bson:"handle,omitempty" json:"handle,omitempty"` // lowercase, without the @
+	HandleChangedAt  time.Time          `bson:"handleChangedAt,omitempty" json:"-"`
+	AvatarURL        string             `bson:"avatarUrl,omitempty" json:"avatarUrl,omitempty"`
 	TwoFASecret      string             `bson:"twofa_secret,omitempty" json:"twofa_secret,omitempty"`
 	CurrencyCode     string             `bson:"currencyCode,omitempty" json:"currencyCode,omitempty"`
+	Status           string             `bson:"status,omitempty" json:"status,omitempty"`
+	Freeze           *AccountFreeze     `bson:"freeze,omitempty" json:"freeze,omitempty"`
+	Deletion         *AccountDeletion   `bson:"deletion,omitempty" json:"deletion,omitempty"`
+	SecurityPolicy   *SecurityPolicy    `bson:"securityPolicy,omitempty" json:"-"`
+	SessionsRevoked  time.Time          `bson:"sessionsRevokedAt,omitempty" json:"-"` // tokens issued before this are rejected
+}
+
+func (u User) IsFrozen() bool {
+	return u.Status == AccountStatusFrozen
+}
+
+func (u User) IsPendingDeletion() bool {
+	return u.Status == AccountStatusPendingDeletion
+}
+
+// RequiredFactors lists the factors the user's security policy demands for an action
+func (u User) RequiredFactors(action string) []string {
+	if u.SecurityPolicy == nil {
+		return nil
+	}
+	return u.SecurityPolicy.Actions[action]
 }
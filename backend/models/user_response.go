@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// UserResponse is the public shape of a user returned by the API. Fields are
+// only ever added here, so clients can rely on it; never return User itself.
+type UserResponse struct {
+	ID                string           `json:"id"`
+	EID               string           `json:"eid"`
+	Email             string           `json:"email"`
+	FirstName         string           `json:"firstName"`
+	LastName          string           `json:"lastName"`
+	Gender            string           `json:"gender"`
+	DateOfBirth       string           `json:"dob"` // YYYY-MM-DD
+	Country           CountryResponse  `json:"country"`
+	Language          LanguageResponse `json:"language"`
+	Phone             string           `json:"phone"`
+	Handle            string           `json:"handle"`
+	AvatarURL         string           `json:"avatarUrl"`
+	CurrencyCode      string           `json:"currencyCode"`
+	Status            string           `json:"status"`
+	CreatedAt         time.Time        `json:"createdAt"`
+	PinRegistered     bool             `json:"pinRegistered"`
+	PatternRegistered bool             `json:"patternRegistered"`
+	TwoFactorEnabled  bool             `json:"twoFactorEnabled"`
+}
+
+type CountryResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Flag string `json:"flag"`
+}
+
+type LanguageResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	NativeName string `json:"nativeName"`
+	Flag       string `json:"flag"`
+}
+
+func NewUserResponse(u User) UserResponse {
+	status := u.Status
+	if status == AccountStatusActive {
+		status = "active"
+	}
+
+	dob := ""
+	if !u.DateOfBirth.IsZero() {
+		dob = u.DateOfBirth.Format("2006-01-02")
+	}
+
+	return UserResponse{
+		ID:                u.ID.Hex(),
+		EID:               u.EID,
+		Email:             u.Email,
+		FirstName:         u.FirstName,
+		LastName:          u.LastName,
+		Gender:            u.Gender,
+		DateOfBirth:       dob,
+		Country:           CountryResponse{ID: u.Country.ID, Name: u.Country.Name, Flag: u.Country.Flag},
+		Language:          LanguageResponse{ID: u.Language.ID, Name: u.Language.Name, NativeName: u.Language.NativeName, Flag: u.Language.Flag},
+		Phone:             u.Phone,
+		Handle:            u.Handle,
+		AvatarURL:         u.AvatarURL,
+		CurrencyCode:      u.CurrencyCode,
+		Status:            status,
+		CreatedAt:         u.CreatedAt,
+		PinRegistered:     u.Pin != "",
+		PatternRegistered: u.PatternHash != "",
+		TwoFactorEnabled:  u.TwoFASecret != "",
+	}
+}
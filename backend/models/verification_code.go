@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of emailed verification codes. A code only verifies the purpose it was sent for.
+const (
+	CodePurposeSignIn        = "sign_in"
+	CodePurposePasswordReset = "password_reset"
+	CodePurposeStepUp        = "step_up"
+	CodePurposeUnfreeze      = "unfreeze"
+)
+
+// VerificationCode is a one-time code emailed to an account for one purpose.
+// There's one document per account and purpose; sending a new code replaces the old one.
+type VerificationCode struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Purpose   string             `bson:"purpose"`
+	CodeHash  string             `bson:"codeHash,omitempty"` // unset once the code is used
+	Attempts  int                `bson:"attempts"`           // wrong guesses at the current code
+	Sends     int                `bson:"sends"`              // drives the resend cooldown
+	SentAt    time.Time          `bson:"sentAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AccountRoutes(r *gin.Engine, controller *controllers.AccountController) {
+	r.GET("/account/freeze-reasons", controller.FreezeReasons)
+	r.POST("/account/freeze", middleware.AuthMiddleware(), controller.FreezeAccount)
+	r.POST("/account/unfreeze/send-code", controller.SendUnfreezeCode)
+	r.POST("/account/unfreeze", controller.UnfreezeAccount)
+	// kill-switch link from security emails, no auth
+	r.GET("/account/emergency-freeze", controller.EmergencyFreezePage)
+	r.POST("/account/emergency-freeze", controller.EmergencyFreeze)
+	// deletion, cancelled by signing in during the grace period
+	r.POST("/account/delete/send-code", middleware.AuthMiddleware(), controller.SendDeletionCode)
+	r.POST("/account/delete", middleware.AuthMiddleware(), controller.RequestDeletion)
+}
+
+// personal data export (GDPR access request) routes
+
+func DataExportRoutes(r *gin.Engine, controller *controllers.DataExportController) {
+	r.POST("/account/export", middleware.AuthMiddleware(), controller.RequestDataExport)
+	r.GET("/account/export/:id", middleware.AuthMiddleware(), controller.GetDataExport)
+	r.GET("/account/export/download", controller.DownloadDataExport)
+}
+
+// email change routes; the cancel link from the notice to the old address needs no auth
+
+func EmailChangeRoutes(r *gin.Engine, controller *controllers.EmailChangeController) {
+	r.POST("/account/email-change", middleware.AuthMiddleware(), controller.RequestEmailChange)
+	r.GET("/account/email-change", middleware.AuthMiddleware(), controller.GetEmailChange)
+	r.DELETE("/account/email-change", middleware.AuthMiddleware(), controller.CancelOwnEmailChange)
+	r.POST("/account/email-change/confirm", middleware.AuthMiddleware(), controller.ConfirmEmailChange)
+	r.GET("/account/email-change/cancel", controller.CancelEmailChangePage)
+	r.POST("/account/email-change/cancel", controller.CancelEmailChange)
+}
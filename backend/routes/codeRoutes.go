@@ -2,6 +2,7 @@ package routes
 
 import (
 	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +18,9 @@ func CodeRoutes(r *gin.Engine, controller *controllers.CodeController) {
 	r.POST("/send-eid-code", controller.GetEIDCode)
 	r.POST("/verify-eid-code", controller.VerifyEIDCode)
 	r.POST("/forgot-eid", controller.ForgotEID)
+	// Extra factors required by a user's security policy
+	r.POST("/send-sms-code", controller.SendSMSCode)
+	r.POST("/security/step-up/send-code", middleware.AuthMiddleware(), controller.SendStepUpCode)
 
 }
 
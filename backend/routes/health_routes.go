@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func HealthRoutes(r *gin.Engine, controller *controllers.HealthController) {
+	r.GET("/health/eid-pool", controller.EIDPoolHealth)
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func MagicLinkRoutes(r *gin.Engine, controller *controllers.MagicLinkController) {
+	r.POST("/magic-link/request", controller.RequestMagicLink)
+	r.POST("/magic-link/redeem", controller.RedeemMagicLink)
+	r.GET("/magic-link/redeem", controller.RedeemMagicLink)
+}
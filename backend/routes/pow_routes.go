@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PowRoutes(r *gin.Engine, controller *controllers.PowController) {
+	r.POST("/pow/challenge", controller.IssueChallenge)
+}
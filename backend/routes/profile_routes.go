@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ProfileRoutes(r *gin.Engine, controller *controllers.ProfileController) {
+	r.GET("/profiles", middleware.AuthMiddleware(), controller.ListProfiles)
+	r.POST("/profiles", middleware.AuthMiddleware(), controller.CreateProfile)
+	r.PATCH("/profiles/:id", middleware.AuthMiddleware(), controller.UpdateProfile)
+	r.DELETE("/profiles/:id", middleware.AuthMiddleware(), controller.DeleteProfile)
+	r.POST("/profiles/:id/switch", middleware.AuthMiddleware(), controller.SwitchProfile)
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func QRLoginRoutes(r *gin.Engine, controller *controllers.QRLoginController) {
+	// new device
+	r.POST("/qr-login/requests", controller.CreateLoginRequest)
+	r.GET("/qr-login/requests/:id/wait", controller.WaitLoginRequest)
+	// signed-in device
+	r.GET("/qr-login/requests/:id", middleware.AuthMiddleware(), controller.GetLoginRequest)
+	r.POST("/qr-login/requests/:id/approve", middleware.AuthMiddleware(), controller.ApproveLoginRequest)
+	r.POST("/qr-login/requests/:id/deny", middleware.AuthMiddleware(), controller.DenyLoginRequest)
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ReferralRoutes(r *gin.Engine, controller *controllers.ReferralController) {
+	r.GET("/referrals/code", middleware.AuthMiddleware(), controller.GetReferralCode)
+	r.GET("/referrals/invitees", middleware.AuthMiddleware(), controller.ListInvitees)
+	r.GET("/referrals/stats", middleware.AuthMiddleware(), controller.ReferralStats)
+}
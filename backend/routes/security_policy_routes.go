@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"flutter_project_backend/controllers"
+	"flutter_project_backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SecurityPolicyRoutes(r *gin.Engine, controller *controllers.SecurityPolicyController) {
+	r.GET("/security/policy", middleware.AuthMiddleware(), controller.GetSecurityPolicy)
+	r.PUT("/security/policy", middleware.AuthMiddleware(), controller.UpdateSecurityPolicy)
+	// Phone number for the SMS factor
+	r.POST("/security/phone", middleware.AuthMiddleware(), controller.StartPhoneEnrollment)
+	r.POST("/security/phone/verify", middleware.AuthMiddleware(), controller.VerifyPhoneEnrollment)
+	r.DELETE("/security/phone", middleware.AuthMiddleware(), controller.RemovePhone)
+}
@@ -6,16 +6,9 @@ import (
 	"flutter_project_backend/middleware"
 
 	"github.com/gin-gonic/gin"
-
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func UserRoutes(r *gin.Engine, userCollection *mongo.Collection, codeController *controllers.CodeController) {
-	controller := controllers.UserController{
-		UserCollection: userCollection,
-		CodeController: codeController,
-	}
-
+func UserRoutes(r *gin.Engine, controller *controllers.UserController) {
 	r.POST("/send-code", controller.SendCode)
 	r.POST("/register", controller.Register)
 	r.POST("/sign-in", controller.SignIn)
@@ -23,13 +16,40 @@ func UserRoutes(r *gin.Engine, userCollection *mongo.Collection, codeController
 	r.POST("/migrate-users-eid", controller.MigrateUsersEID)
 	// r.POST("/send-code-sign-in", controller.SendCodeSignIn)
 	r.POST("/check-eid", controller.CheckEID)
+	r.POST("/check-handle", controller.CheckHandle)
+	r.GET("/users/lookup/:identifier", controller.LookupUser)
 	r.POST("/register-pin", middleware.AuthMiddleware(), controller.RegisterPin)
 	r.POST("/validate-pin", middleware.AuthMiddleware(), controller.ValidatePin)
 	r.POST("/register-pattern", middleware.AuthMiddleware(), controller.RegisterPattern)
 	r.POST("/validate-pattern", middleware.AuthMiddleware(), controller.ValidatePattern)
+	r.POST("/change-password", middleware.AuthMiddleware(), controller.ChangePassword)
+	r.POST("/change-pin", middleware.AuthMiddleware(), controller.ChangePin)
+	r.POST("/change-pattern", middleware.AuthMiddleware(), controller.ChangePattern)
 	r.POST("/logout", middleware.AuthMiddleware(), controller.Logout)
 	// Forgot Password Routes
 	r.POST("/reset-password", controller.ResetPassword)
 	r.PUT("/users/currency", middleware.AuthMiddleware(), controller.SetCurrency)
+	r.GET("/me", middleware.AuthMiddleware(), controller.GetMe)
+	r.PATCH("/me", middleware.AuthMiddleware(), controller.UpdateMe)
+	r.PUT("/me/handle", middleware.AuthMiddleware(), controller.SetHandle)
+	r.DELETE("/me/handle", middleware.AuthMiddleware(), controller.RemoveHandle)
+
+}
+
+// trusted device routes
+
+func DeviceRoutes(r *gin.Engine, controller *controllers.DeviceController) {
+	r.GET("/trusted-devices", middleware.AuthMiddleware(), controller.ListTrustedDevices)
+	r.DELETE("/trusted-devices/:id", middleware.AuthMiddleware(), controller.RevokeTrustedDevice)
+	r.DELETE("/trusted-devices", middleware.AuthMiddleware(), controller.RevokeAllTrustedDevices)
+}
+
+// device key (biometric quick sign-in) routes
 
+func DeviceKeyRoutes(r *gin.Engine, controller *controllers.DeviceController) {
+	r.POST("/device-keys", middleware.AuthMiddleware(), controller.RegisterDeviceKey)
+	r.GET("/device-keys", middleware.AuthMiddleware(), controller.ListDeviceKeys)
+	r.DELETE("/device-keys/:id", middleware.AuthMiddleware(), controller.DeleteDeviceKey)
+	r.POST("/device-keys/challenge", controller.DeviceKeyChallenge)
+	r.POST("/device-keys/sign-in", controller.DeviceKeySignIn)
 }
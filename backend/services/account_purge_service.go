@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"flutter_project_backend/models"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collections holding per-user documents keyed by userId, removed on purge
+var purgeUserIDCollections = []string{
+	"trusted_devices",
+	"login_events",
+	"device_keys",
+	"device_challenges",
+	"magic_links",
+	"data_exports",
+	"profiles",
+	"email_changes",
+	"sms_codes",
+	"verification_codes",
+}
+
+// StartAccountPurge purges accounts whose deletion grace period has ended,
+// once at startup and then every interval.
+func StartAccountPurge(db *mongo.Database, interval time.Duration) {
+	go func() {
+		for {
+			purged, err := PurgeDeletedAccounts(db)
+			if err != nil {
+				log.Println("Account purge failed:", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted accounts", purged)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// PurgeDeletedAccounts hard-deletes every account past its purge date and
+// retires its EID. It returns how many accounts were removed.
+func PurgeDeletedAccounts(db *mongo.Database) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := db.Collection("users").Find(ctx, bson.M{
+		"status":           models.AccountStatusPendingDeletion,
+		"deletion.purgeAt": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var accounts []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Email string             `bson:"email"`
+		EID   string             `bson:"eid"`
+	}
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, account := range accounts {
+		if err := purgeAccount(ctx, db, account.ID, account.Email, account.EID); err != nil {
+			// left in place, the next run retries it
+			log.Printf("Failed to purge account %s: %v", account.ID.Hex(), err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeAccount removes the user's data everywhere, deleting the user document
+// last so a partial failure is picked up again on the next run
+func purgeAccount(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, email, eid string) error {
+	if eid != "" {
+		_, err := db.Collection("retired_eids").InsertOne(ctx, models.RetiredEID{EID: eid, RetiredAt: time.Now()})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	for _, name := range purgeUserIDCollections {
+		if _, err := db.Collection(name).DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.Collection("login_requests").DeleteMany(ctx, bson.M{"approvedBy": userID}); err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("email_codes").DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return err
+	}
+
+	// the sponsor keeps a cancelled entry; the purged account's own invitees just lose their sponsor
+	_, err := db.Collection("referrals").UpdateMany(ctx,
+		bson.M{"inviteeId": userID},
+		bson.M{"$set": bson.M{"status": models.ReferralCancelled}},
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Collection("referrals").DeleteMany(ctx, bson.M{"sponsorId": userID}); err != nil {
+		return err
+	}
+
+	// only delete if the user didn't cancel while we were busy
+	_, err = db.Collection("users").DeleteOne(ctx, bson.M{
+		"_id":    userID,
+		"status": models.AccountStatusPendingDeletion,
+	})
+	return err
+}
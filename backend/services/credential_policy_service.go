@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PIN and unlock-pattern strength rules used wherever a new PIN or pattern is set.
+// Existing PINs and patterns are never re-checked, so tightening the policy
+// doesn't lock anyone out.
+
+var (
+	ErrPinDigits     = errors.New("PIN must contain digits only")
+	ErrPinCommon     = errors.New("PIN is too common, choose a different one")
+	ErrPinSequential = errors.New("PIN can't be a sequence like 1234 or 9876")
+	ErrPinRepeated   = errors.New("PIN can't be a repeated digit or group like 1111 or 1212")
+
+	ErrPatternOutOfGrid = errors.New("pattern uses a dot outside the 3x3 grid")
+	ErrPatternDuplicate = errors.New("pattern can't use the same dot twice")
+	ErrPatternSkipsDot  = errors.New("pattern can't jump over a dot it hasn't used yet")
+	ErrPatternTooSimple = errors.New("pattern is too simple, add more dots or turns")
+)
+
+// commonPins are the most used PINs that aren't already caught by the sequence
+// and repetition rules
+var commonPins = map[string]bool{
+	"1004": true, "2000": true, "2001": true, "6969": true, "1122": true,
+	"1313": true, "2580": true, "0852": true, "1998": true, "1999": true,
+	"1984": true, "1986": true, "1987": true, "1990": true, "5683": true,
+	"7410": true, "0147": true, "3698": true, "1793": true, "4560": true,
+	"112233": true, "121212": true, "123321": true, "654321": true,
+	"159753": true, "147258": true, "11223344": true, "12344321": true,
+}
+
+// PinLengthBounds reads PIN_MIN_LENGTH and PIN_MAX_LENGTH, both kept within 4-8
+// and defaulting to exactly 4
+func PinLengthBounds() (int, int) {
+	clamp := func(n int) int {
+		if n < 4 {
+			return 4
+		}
+		if n > 8 {
+			return 8
+		}
+		return n
+	}
+
+	minLen, err := strconv.Atoi(os.Getenv("PIN_MIN_LENGTH"))
+	if err != nil {
+		minLen = 4
+	}
+	maxLen, err := strconv.Atoi(os.Getenv("PIN_MAX_LENGTH"))
+	if err != nil {
+		maxLen = minLen
+	}
+
+	minLen, maxLen = clamp(minLen), clamp(maxLen)
+	if maxLen < minLen {
+		maxLen = minLen
+	}
+	return minLen, maxLen
+}
+
+// ValidateNewPin checks a PIN the user is about to set
+func ValidateNewPin(pin string) error {
+	minLen, maxLen := PinLengthBounds()
+	if len(pin) < minLen || len(pin) > maxLen {
+		if minLen == maxLen {
+			return fmt.Errorf("PIN must be %d digits", minLen)
+		}
+		return fmt.Errorf("PIN must be %d to %d digits", minLen, maxLen)
+	}
+
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return ErrPinDigits
+		}
+	}
+
+	if repeatsUnit(pin) {
+		return ErrPinRepeated
+	}
+	if isSequential(pin, 1) || isSequential(pin, -1) {
+		return ErrPinSequential
+	}
+	if commonPins[pin] || extraBlockedPin(pin) {
+		return ErrPinCommon
+	}
+	return nil
+}
+
+// extraBlockedPin checks PIN_BLACKLIST, a comma-separated list added to commonPins
+func extraBlockedPin(pin string) bool {
+	for _, blocked := range strings.Split(os.Getenv("PIN_BLACKLIST"), ",") {
+		if strings.TrimSpace(blocked) == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatsUnit reports whether s is a shorter group repeated, like 1111, 1212 or 123123
+func repeatsUnit(s string) bool {
+	for size := 1; size <= len(s)/2; size++ {
+		if len(s)%size == 0 && strings.Repeat(s[:size], len(s)/size) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isSequential reports whether every digit is the previous plus step, wrapping 9 to 0
+func isSequential(s string, step int) bool {
+	for i := 1; i < len(s); i++ {
+		if (int(s[i-1]-'0')+step+10)%10 != int(s[i]-'0') {
+			return false
+		}
+	}
+	return true
+}
+
+// PatternMinDots reads PATTERN_MIN_DOTS, defaulting to 4
+func PatternMinDots() int {
+	n, err := strconv.Atoi(os.Getenv("PATTERN_MIN_DOTS"))
+	if err != nil || n < 4 || n > 9 {
+		return 4
+	}
+	return n
+}
+
+// PatternMinScore reads PATTERN_MIN_SCORE, defaulting to 7
+func PatternMinScore() int {
+	n, err := strconv.Atoi(os.Getenv("PATTERN_MIN_SCORE"))
+	if err != nil || n < 0 {
+		return 7
+	}
+	return n
+}
+
+// ValidatePatternGeometry checks the dots (0-8, row by row) form a pattern that
+// can actually be drawn on a 3x3 grid: no dot outside it, no dot used twice and
+// no jumping over an unvisited middle dot.
+func ValidatePatternGeometry(dots []int) error {
+	visited := make([]bool, 9)
+	for i, dot := range dots {
+		if dot < 0 || dot > 8 {
+			return ErrPatternOutOfGrid
+		}
+		if visited[dot] {
+			return ErrPatternDuplicate
+		}
+
+		if i > 0 {
+			prev := dots[i-1]
+			dr, dc := dot/3-prev/3, dot%3-prev%3
+			// a straight move of two rows and/or columns passes over the middle dot
+			if dr%2 == 0 && dc%2 == 0 {
+				middle := (prev + dot) / 2
+				if !visited[middle] {
+					return ErrPatternSkipsDot
+				}
+			}
+		}
+		visited[dot] = true
+	}
+	return nil
+}
+
+// PatternScore rates a valid pattern: one point per dot, two per change of
+// direction and two per knight move (like 0 to 5) or pass over a used dot.
+func PatternScore(dots []int) int {
+	score := len(dots)
+	prevDir := [2]int{}
+	for i := 1; i < len(dots); i++ {
+		dr, dc := dots[i]/3-dots[i-1]/3, dots[i]%3-dots[i-1]%3
+		adr, adc := abs(dr), abs(dc)
+
+		if (adr == 2 && adc == 1) || (adr == 1 && adc == 2) || (adr%2 == 0 && adc%2 == 0) {
+			score += 2
+		}
+
+		dir := [2]int{sign(dr), sign(dc)}
+		if adr != adc && adr != 0 && adc != 0 {
+			dir = [2]int{dr, dc} // knight moves keep their own direction
+		}
+		if i > 1 && dir != prevDir {
+			score += 2
+		}
+		prevDir = dir
+	}
+	return score
+}
+
+// ValidateNewPattern checks a pattern the user is about to set
+func ValidateNewPattern(dots []int) error {
+	if len(dots) < PatternMinDots() {
+		return fmt.Errorf("pattern must have at least %d dots", PatternMinDots())
+	}
+	if err := ValidatePatternGeometry(dots); err != nil {
+		return err
+	}
+	if PatternScore(dots) < PatternMinScore() {
+		return ErrPatternTooSimple
+	}
+	return nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
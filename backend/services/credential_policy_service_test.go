@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateNewPin(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     string
+		wantErr error
+		invalid bool // an error without a sentinel, like the length message
+	}{
+		{name: "fine", pin: "4827"},
+		{name: "too short", pin: "482", invalid: true},
+		{name: "too long by default", pin: "48271", invalid: true},
+		{name: "letters", pin: "48a7", wantErr: ErrPinDigits},
+		{name: "same digit", pin: "1111", wantErr: ErrPinRepeated},
+		{name: "repeated pair", pin: "1212", wantErr: ErrPinRepeated},
+		{name: "ascending", pin: "1234", wantErr: ErrPinSequential},
+		{name: "descending", pin: "9876", wantErr: ErrPinSequential},
+		{name: "sequence wraps 9 to 0", pin: "8901", wantErr: ErrPinSequential},
+		{name: "common", pin: "2580", wantErr: ErrPinCommon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNewPin(tt.pin)
+			switch {
+			case tt.invalid:
+				if err == nil {
+					t.Fatalf("ValidateNewPin(%q) = nil, want an error", tt.pin)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("ValidateNewPin(%q) = %v, want %v", tt.pin, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNewPinConfig(t *testing.T) {
+	t.Setenv("PIN_MIN_LENGTH", "4")
+	t.Setenv("PIN_MAX_LENGTH", "6")
+	t.Setenv("PIN_BLACKLIST", "4827, 5193")
+
+	tests := []struct {
+		pin string
+		ok  bool
+	}{
+		{pin: "482719", ok: true},
+		{pin: "48271", ok: true},
+		{pin: "4827193", ok: false},
+		{pin: "123123", ok: false},
+		{pin: "5193", ok: false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateNewPin(tt.pin); (err == nil) != tt.ok {
+			t.Errorf("ValidateNewPin(%q) = %v, want ok %v", tt.pin, err, tt.ok)
+		}
+	}
+}
+
+func TestPinLengthBoundsClamp(t *testing.T) {
+	t.Setenv("PIN_MIN_LENGTH", "2")
+	t.Setenv("PIN_MAX_LENGTH", "12")
+
+	if minLen, maxLen := PinLengthBounds(); minLen != 4 || maxLen != 8 {
+		t.Fatalf("PinLengthBounds() = %d, %d, want 4, 8", minLen, maxLen)
+	}
+}
+
+func TestValidatePatternGeometry(t *testing.T) {
+	tests := []struct {
+		name    string
+		dots    []int
+		wantErr error
+	}{
+		{name: "row then column", dots: []int{0, 1, 2, 5, 8}},
+		{name: "knight moves", dots: []int{0, 5, 6, 1}},
+		{name: "outside the grid", dots: []int{0, 1, 9}, wantErr: ErrPatternOutOfGrid},
+		{name: "negative dot", dots: []int{-1, 0, 1}, wantErr: ErrPatternOutOfGrid},
+		{name: "dot used twice", dots: []int{0, 1, 0}, wantErr: ErrPatternDuplicate},
+		{name: "jumps an unused dot in a row", dots: []int{0, 2, 5, 8}, wantErr: ErrPatternSkipsDot},
+		{name: "jumps an unused dot in a column", dots: []int{1, 7, 8, 5}, wantErr: ErrPatternSkipsDot},
+		{name: "jumps the unused centre", dots: []int{2, 6, 7, 8}, wantErr: ErrPatternSkipsDot},
+		{name: "passes over a used dot", dots: []int{1, 0, 2, 5}},
+		{name: "passes over the used centre", dots: []int{4, 0, 8, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePatternGeometry(tt.dots); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidatePatternGeometry(%v) = %v, want %v", tt.dots, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatternScore(t *testing.T) {
+	tests := []struct {
+		name string
+		dots []int
+		want int
+	}{
+		// 4 dots + 1 turn
+		{name: "L shape", dots: []int{0, 1, 2, 5}, want: 6},
+		// 5 dots + 1 turn
+		{name: "longer L shape", dots: []int{0, 1, 2, 5, 8}, want: 7},
+		// 4 dots + 3 knight moves + 2 turns
+		{name: "knight moves", dots: []int{0, 5, 6, 1}, want: 14},
+		// 4 dots + 1 pass over a used dot + 2 turns
+		{name: "passes over a used dot", dots: []int{1, 0, 2, 5}, want: 10},
+		// 3 dots in a straight line, no turns
+		{name: "straight line", dots: []int{0, 1, 2}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PatternScore(tt.dots); got != tt.want {
+				t.Fatalf("PatternScore(%v) = %d, want %d", tt.dots, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNewPatternDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		dots    []int
+		wantErr error
+		invalid bool
+	}{
+		{name: "too few dots", dots: []int{0, 1, 2}, invalid: true},
+		{name: "scores 6, below the default 7", dots: []int{0, 1, 2, 5}, wantErr: ErrPatternTooSimple},
+		{name: "scores exactly 7", dots: []int{0, 1, 2, 5, 8}},
+		{name: "skips a dot", dots: []int{0, 2, 5, 8}, wantErr: ErrPatternSkipsDot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNewPattern(tt.dots)
+			switch {
+			case tt.invalid:
+				if err == nil {
+					t.Fatalf("ValidateNewPattern(%v) = nil, want an error", tt.dots)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Fatalf("ValidateNewPattern(%v) = %v, want %v", tt.dots, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNewPatternConfig(t *testing.T) {
+	t.Setenv("PATTERN_MIN_DOTS", "5")
+	t.Setenv("PATTERN_MIN_SCORE", "0")
+
+	if err := ValidateNewPattern([]int{0, 1, 2, 5}); err == nil {
+		t.Fatal("4 dots passed with PATTERN_MIN_DOTS=5")
+	}
+	if err := ValidateNewPattern([]int{0, 1, 2, 5, 8}); err != nil {
+		t.Fatalf("5 dots with PATTERN_MIN_SCORE=0: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flutter_project_backend/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BuildUserExport collects everything stored about a user into a ZIP of JSON
+// files. Passwords, PINs, patterns, TOTP secrets, keys and token hashes are
+// never copied in.
+func BuildUserExport(ctx context.Context, db *mongo.Database, user models.User) ([]byte, error) {
+	var trustedDevices []models.TrustedDevice
+	if err := findAll(ctx, db.Collection("trusted_devices"), bson.M{"userId": user.ID}, &trustedDevices); err != nil {
+		return nil, err
+	}
+
+	var deviceKeys []models.DeviceKey
+	if err := findAll(ctx, db.Collection("device_keys"), bson.M{"userId": user.ID}, &deviceKeys); err != nil {
+		return nil, err
+	}
+
+	var loginEvents []models.LoginEvent
+	if err := findAll(ctx, db.Collection("login_events"), bson.M{"userId": user.ID}, &loginEvents); err != nil {
+		return nil, err
+	}
+
+	var magicLinks []models.MagicLink
+	if err := findAll(ctx, db.Collection("magic_links"), bson.M{"userId": user.ID}, &magicLinks); err != nil {
+		return nil, err
+	}
+
+	var profiles []models.Profile
+	if err := findAll(ctx, db.Collection("profiles"), bson.M{"userId": user.ID}, &profiles); err != nil {
+		return nil, err
+	}
+
+	var emailChanges []models.EmailChange
+	if err := findAll(ctx, db.Collection("email_changes"), bson.M{"userId": user.ID}, &emailChanges); err != nil {
+		return nil, err
+	}
+
+	// invitees are other people's accounts, so only the referral records themselves are included
+	var referrals []models.Referral
+	if err := findAll(ctx, db.Collection("referrals"), bson.M{"sponsorId": user.ID}, &referrals); err != nil {
+		return nil, err
+	}
+
+	var loginRequests []models.LoginRequest
+	if err := findAll(ctx, db.Collection("login_requests"), bson.M{"approvedBy": user.ID}, &loginRequests); err != nil {
+		return nil, err
+	}
+
+	magicLinkData := make([]map[string]interface{}, 0, len(magicLinks))
+	for _, link := range magicLinks {
+		magicLinkData = append(magicLinkData, map[string]interface{}{
+			"ip":        link.IP,
+			"createdAt": link.CreatedAt,
+			"expiresAt": link.ExpiresAt,
+			"usedAt":    link.UsedAt,
+		})
+	}
+
+	loginRequestData := make([]map[string]interface{}, 0, len(loginRequests))
+	for _, request := range loginRequests {
+		loginRequestData = append(loginRequestData, map[string]interface{}{
+			"status":     request.Status,
+			"deviceName": request.DeviceName,
+			"ip":         request.IP,
+			"createdAt":  request.CreatedAt,
+			"approvedAt": request.ApprovedAt,
+		})
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", map[string]interface{}{
+			"id":           user.ID.Hex(),
+			"eid":          user.EID,
+			"firstName":    user.FirstName,
+			"lastName":     user.LastName,
+			"email":        user.Email,
+			"phone":        user.Phone,
+			"gender":       user.Gender,
+			"dateOfBirth":  user.DateOfBirth.Format("2006-01-02"),
+			"sponsorCode":  user.SponsorCode,
+			"referralCode": user.ReferralCode,
+			"createdAt":    user.CreatedAt,
+			"status":       user.Status,
+			"freeze":       user.Freeze,
+			"deletion":     user.Deletion,
+		}},
+		{"preferences.json", map[string]interface{}{
+			"country":          user.Country,
+			"language":         user.Language,
+			"currencyCode":     user.CurrencyCode,
+			"twoFactorEnabled": user.TwoFASecret != "",
+			"pinEnabled":       user.Pin != "",
+			"patternEnabled":   user.PatternHash != "",
+			"profiles":         nonNil(profiles),
+		}},
+		{"sessions.json", map[string]interface{}{
+			"trustedDevices": nonNil(trustedDevices),
+			"deviceKeys":     nonNil(deviceKeys),
+		}},
+		{"security_events.json", map[string]interface{}{
+			"loginEvents":       nonNil(loginEvents),
+			"sessionsRevokedAt": user.SessionsRevoked,
+			"emailChanges":      nonNil(emailChanges),
+		}},
+		{"linked_data.json", map[string]interface{}{
+			"magicLinks":       magicLinkData,
+			"qrLoginsApproved": loginRequestData,
+			"referrals":        nonNil(referrals),
+		}},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, out interface{}) error {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, out)
+}
+
+// nonNil makes empty collections export as [] instead of null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+const (
+	DeviceKeyEd25519 = "ed25519"
+	DeviceKeyP256    = "p256"
+)
+
+var ErrUnsupportedDeviceKey = errors.New("public key must be an Ed25519 or P-256 key")
+
+// ParseDevicePublicKey decodes a base64 PKIX public key and reports its algorithm
+func ParseDevicePublicKey(encoded string) (string, error) {
+	_, alg, err := decodeDevicePublicKey(encoded)
+	return alg, err
+}
+
+// VerifyDeviceSignature checks a base64 signature over message with a registered device key.
+// P-256 signatures may be ASN.1 DER (Android Keystore, Secure Enclave) or raw r||s.
+func VerifyDeviceSignature(encodedKey, message, encodedSig string) bool {
+	key, _, err := decodeDevicePublicKey(encodedKey)
+	if err != nil {
+		return false
+	}
+
+	sig, err := decodeBase64(encodedSig)
+	if err != nil {
+		return false
+	}
+
+	switch pub := key.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, []byte(message), sig)
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256([]byte(message))
+		if len(sig) == 64 {
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			return ecdsa.Verify(pub, digest[:], r, s)
+		}
+		return ecdsa.VerifyASN1(pub, digest[:], sig)
+	}
+	return false
+}
+
+func decodeDevicePublicKey(encoded string) (interface{}, string, error) {
+	der, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, "", ErrUnsupportedDeviceKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, "", ErrUnsupportedDeviceKey
+	}
+
+	switch pub := key.(type) {
+	case ed25519.PublicKey:
+		return pub, DeviceKeyEd25519, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, "", ErrUnsupportedDeviceKey
+		}
+		return pub, DeviceKeyP256, nil
+	}
+	return nil, "", ErrUnsupportedDeviceKey
+}
+
+// decodeBase64 accepts standard and URL-safe base64, padded or not
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
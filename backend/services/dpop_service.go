@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DPoPMaxAge is how far a proof's iat may drift from the server clock
+const DPoPMaxAge = 60 * time.Second
+
+var (
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	ErrDPoPReplay       = errors.New("DPoP proof already used")
+)
+
+var dpopProofCollection *mongo.Collection
+
+// InitDPoPReplayStore sets the collection used to remember seen proof ids.
+// A unique _id makes the check safe across several API instances.
+func InitDPoPReplayStore(collection *mongo.Collection) {
+	dpopProofCollection = collection
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println("Failed to create DPoP proof indexes:", err)
+	}
+}
+
+type dpopJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+}
+
+// VerifyDPoPProof validates a DPoP proof for the given request and returns the
+// JWK thumbprint of the key that signed it. accessToken is empty when the proof
+// is presented to obtain a token, and set when it accompanies a bound token.
+func VerifyDPoPProof(ctx context.Context, proof, method, requestURL, accessToken string) (string, error) {
+	var jwk dpopJWK
+
+	token, err := jwt.Parse(proof, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		raw, err := json.Marshal(t.Header["jwk"])
+		if err != nil || json.Unmarshal(raw, &jwk) != nil {
+			return nil, ErrInvalidDPoPProof
+		}
+		if jwk.D != "" {
+			return nil, ErrInvalidDPoPProof // private key material must never be sent
+		}
+		return jwk.publicKey()
+	}, jwt.WithValidMethods([]string{"ES256", "EdDSA"}))
+	if err != nil {
+		return "", ErrInvalidDPoPProof
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidDPoPProof
+	}
+
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	jti, _ := claims["jti"].(string)
+	iat, _ := claims["iat"].(float64)
+
+	if !strings.EqualFold(htm, method) || !sameURL(htu, requestURL) || jti == "" {
+		return "", ErrInvalidDPoPProof
+	}
+
+	issued := time.Unix(int64(iat), 0)
+	if time.Since(issued) > DPoPMaxAge || time.Until(issued) > DPoPMaxAge {
+		return "", ErrInvalidDPoPProof
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", ErrInvalidDPoPProof
+		}
+	}
+
+	thumbprint, err := jwk.thumbprint()
+	if err != nil {
+		return "", ErrInvalidDPoPProof
+	}
+
+	if err := rememberDPoPProof(ctx, thumbprint, jti); err != nil {
+		return "", err
+	}
+
+	return thumbprint, nil
+}
+
+// rememberDPoPProof rejects a jti that was already seen for this key
+func rememberDPoPProof(ctx context.Context, thumbprint, jti string) error {
+	if dpopProofCollection == nil {
+		return errors.New("DPoP replay store not initialised")
+	}
+
+	_, err := dpopProofCollection.InsertOne(ctx, bson.M{
+		"_id":       thumbprint + ":" + jti,
+		"expiresAt": time.Now().Add(2 * DPoPMaxAge),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDPoPReplay
+	}
+	return err
+}
+
+func (k dpopJWK) publicKey() (interface{}, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, ErrInvalidDPoPProof
+	}
+
+	switch {
+	case k.Kty == "EC" && k.Crv == "P-256":
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil || len(x) != 32 || len(y) != 32 {
+			return nil, ErrInvalidDPoPProof
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrInvalidDPoPProof
+		}
+		return pub, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidDPoPProof
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrInvalidDPoPProof
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint (required members in lexicographic order)
+func (k dpopJWK) thumbprint() (string, error) {
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	default:
+		return "", ErrInvalidDPoPProof
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// sameURL compares scheme, host and path, ignoring query and fragment
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Host, ub.Host) &&
+		ua.Path == ub.Path
+}
+
+var dpopTrustedProxies []*net.IPNet
+
+// TrustForwardedHeadersFrom sets the proxies (IPs or CIDRs) whose
+// X-Forwarded-Proto and X-Forwarded-Host DPoPRequestURL believes. With none,
+// the headers are ignored.
+func TrustForwardedHeadersFrom(proxies []string) error {
+	var nets []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	dpopTrustedProxies = nets
+	return nil
+}
+
+// fromTrustedProxy reports whether the request's connecting address is a trusted proxy
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range dpopTrustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// DPoPRequestURL rebuilds the URL the client called (without query). The
+// forwarded scheme and host only count when a trusted proxy sent the request.
+func DPoPRequestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if fromTrustedProxy(r) {
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+		}
+		if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+			host = strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+
+	return scheme + "://" + host + r.URL.Path
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDPoPRequestURLForwardedHeaders(t *testing.T) {
+	t.Cleanup(func() { dpopTrustedProxies = nil })
+	if err := TrustForwardedHeadersFrom([]string{"10.0.0.0/8", "192.0.2.1"}); err != nil {
+		t.Fatalf("TrustForwardedHeadersFrom: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{remoteAddr: "10.1.2.3:40000", want: "https://api.example.com/sign-in"},
+		{remoteAddr: "192.0.2.1:40000", want: "https://api.example.com/sign-in"},
+		{remoteAddr: "203.0.113.9:40000", want: "http://internal:8080/sign-in"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "http://internal:8080/sign-in?x=1", nil)
+		r.RemoteAddr = tt.remoteAddr
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "api.example.com")
+
+		if got := DPoPRequestURL(r); got != tt.want {
+			t.Errorf("DPoPRequestURL from %s = %s, want %s", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestTrustForwardedHeadersFromRejectsBadProxy(t *testing.T) {
+	t.Cleanup(func() { dpopTrustedProxies = nil })
+	if err := TrustForwardedHeadersFrom([]string{"not-an-ip"}); err == nil {
+		t.Fatal("TrustForwardedHeadersFrom accepted an invalid proxy")
+	}
+}
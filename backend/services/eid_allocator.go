@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flutter_project_backend/models"
+	"flutter_project_backend/utils"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Registration used to block on the upstream EID service. The allocator keeps
+// a pool of upstream EIDs in Mongo and, when the pool is empty and upstream is
+// down, makes one locally. The unique index on users.eid is the final guard.
+
+const legacyEIDUpstream = "http://64.227.167.28:9000/api/v1/neweid"
+
+// local EIDs leave out 0/o and 1/l so they're easy to read back
+const localEIDAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+var ErrNoEIDAvailable = errors.New("no unused EID available")
+
+type EIDAllocator struct {
+	Pool     *mongo.Collection // eid_pool
+	Users    *mongo.Collection
+	Retired  *mongo.Collection // retired_eids
+	Upstream string            // empty means local generation only
+	PoolSize int
+
+	refilling   atomic.Bool
+	localIssued atomic.Int64
+
+	mu           sync.Mutex
+	lastRefillAt time.Time
+	lastError    string
+}
+
+// NewEIDAllocator reads EID_UPSTREAM_URL (set it empty to skip upstream; unset
+// keeps the original service) and EID_POOL_SIZE (default 50)
+func NewEIDAllocator(db *mongo.Database) *EIDAllocator {
+	upstream, ok := os.LookupEnv("EID_UPSTREAM_URL")
+	if !ok {
+		upstream = legacyEIDUpstream
+	}
+
+	size, err := strconv.Atoi(os.Getenv("EID_POOL_SIZE"))
+	if err != nil || size < 0 {
+		size = 50
+	}
+
+	return &EIDAllocator{
+		Pool:     db.Collection("eid_pool"),
+		Users:    db.Collection("users"),
+		Retired:  db.Collection("retired_eids"),
+		Upstream: strings.TrimSpace(upstream),
+		PoolSize: size,
+	}
+}
+
+// SetupEIDIndexes makes EIDs unique across accounts. Accounts still waiting
+// for an EID have none (or an empty one) and are left out of the index.
+func SetupEIDIndexes(users, pool *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"eid": 1},
+		Options: options.Index().
+			SetName("unique_eid").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"eid": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		log.Println("Failed to create EID index:", err)
+	}
+
+	_, err = pool.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"fetchedAt": 1}})
+	if err != nil {
+		log.Println("Failed to create EID pool index:", err)
+	}
+}
+
+// Start fills the pool once at startup and then every interval
+func (a *EIDAllocator) Start(interval time.Duration) {
+	go func() {
+		for {
+			a.refill()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Allocate hands out an unused EID: from the pool if it has one, otherwise
+// straight from upstream, otherwise from the local generator
+func (a *EIDAllocator) Allocate(ctx context.Context) (string, error) {
+	for i := 0; i < 5; i++ {
+		eid, err := a.next(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		free, err := a.unused(ctx, eid)
+		if err != nil {
+			return "", err
+		}
+		if free {
+			return eid, nil
+		}
+	}
+	return "", ErrNoEIDAvailable
+}
+
+func (a *EIDAllocator) next(ctx context.Context) (string, error) {
+	var reserved models.ReservedEID
+	err := a.Pool.FindOneAndDelete(ctx, bson.M{},
+		options.FindOneAndDelete().SetSort(bson.M{"fetchedAt": 1}),
+	).Decode(&reserved)
+	if err == nil {
+		if depth, err := a.Pool.EstimatedDocumentCount(ctx); err == nil && depth < int64(a.PoolSize/2) {
+			go a.refill()
+		}
+		return CanonicalEID(reserved.EID)
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", err
+	}
+
+	// pool is empty; don't wait on upstream if the last refill couldn't reach it
+	go a.refill()
+	if a.Upstream != "" && a.upstreamHealthy() {
+		if eid, err := utils.FetchEID(a.Upstream); err == nil {
+			if eid, err := CanonicalEID(eid); err == nil {
+				return eid, nil
+			}
+		}
+	}
+
+	a.localIssued.Add(1)
+	return generateLocalEID()
+}
+
+// unused reports whether no account holds the EID and no purged account retired it
+func (a *EIDAllocator) unused(ctx context.Context, eid string) (bool, error) {
+	taken, err := a.Users.CountDocuments(ctx, bson.M{"eid": EIDFilter(eid)})
+	if err != nil || taken > 0 {
+		return false, err
+	}
+	retired, err := a.Retired.CountDocuments(ctx, bson.M{"_id": EIDFilter(eid)})
+	return retired == 0, err
+}
+
+// refill tops the pool up to PoolSize from upstream. Only one runs at a time.
+func (a *EIDAllocator) refill() {
+	if a.Upstream == "" || !a.refilling.CompareAndSwap(false, true) {
+		return
+	}
+	defer a.refilling.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	depth, err := a.Pool.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		a.recordRefill(err)
+		return
+	}
+
+	for missing := a.PoolSize - int(depth); missing > 0; missing-- {
+		eid, err := utils.FetchEID(a.Upstream)
+		if err == nil {
+			eid, err = CanonicalEID(eid)
+		}
+		if err != nil {
+			a.recordRefill(err)
+			return
+		}
+
+		free, err := a.unused(ctx, eid)
+		if err != nil {
+			a.recordRefill(err)
+			return
+		}
+		if !free {
+			continue
+		}
+
+		_, err = a.Pool.InsertOne(ctx, models.ReservedEID{EID: eid, FetchedAt: time.Now()})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			a.recordRefill(err)
+			return
+		}
+	}
+	a.recordRefill(nil)
+}
+
+func (a *EIDAllocator) recordRefill(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		log.Println("EID pool refill failed:", err)
+		a.lastError = err.Error()
+		return
+	}
+	a.lastRefillAt = time.Now()
+	a.lastError = ""
+}
+
+func (a *EIDAllocator) upstreamHealthy() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastError == ""
+}
+
+// Stats reports the pool depth and refill state for health checks
+func (a *EIDAllocator) Stats(ctx context.Context) (models.EIDPoolStats, error) {
+	depth, err := a.Pool.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return models.EIDPoolStats{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return models.EIDPoolStats{
+		Depth:        depth,
+		Target:       a.PoolSize,
+		Upstream:     a.Upstream,
+		LastRefillAt: a.lastRefillAt,
+		LastError:    a.lastError,
+		LocalIssued:  a.localIssued.Load(),
+	}, nil
+}
+
+// generateLocalEID makes a random EID in the same shape as upstream's, check character included
+func generateLocalEID() (string, error) {
+	eid := make([]byte, eidPayloadLength)
+	for i := range eid {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(localEIDAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		eid[i] = localEIDAlphabet[n.Int64()]
+	}
+	return string(eid) + string(eidCheckChar(string(eid))), nil
+}
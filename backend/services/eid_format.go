@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// An EID is 10 characters from [0-9a-z] followed by a check character (Luhn
+// mod 36), so a mistyped EID is rejected before it reaches the database.
+// Accounts created before the check character existed had just the 10
+// characters; typing those still works, the check character is added here.
+
+const eidAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+const (
+	eidPayloadLength = 10
+	EIDLength        = eidPayloadLength + 1
+)
+
+var (
+	ErrEIDFormat = errors.New("EID must be 11 letters or digits")
+	ErrEIDCheck  = errors.New("EID doesn't look right, check it for typos")
+)
+
+// NormalizeEID lowercases an EID and drops spaces and grouping dashes
+func NormalizeEID(eid string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '-':
+			return -1
+		}
+		return r
+	}, strings.ToLower(eid))
+}
+
+// CanonicalEID normalizes an EID and verifies its check character. A 10-character
+// EID from before the check character is completed rather than rejected.
+func CanonicalEID(eid string) (string, error) {
+	eid = NormalizeEID(eid)
+	for i := 0; i < len(eid); i++ {
+		if strings.IndexByte(eidAlphabet, eid[i]) < 0 {
+			return "", ErrEIDFormat
+		}
+	}
+
+	switch len(eid) {
+	case eidPayloadLength:
+		return eid + string(eidCheckChar(eid)), nil
+	case EIDLength:
+		if eidCheckChar(eid[:eidPayloadLength]) != eid[eidPayloadLength] {
+			return "", ErrEIDCheck
+		}
+		return eid, nil
+	}
+	return "", ErrEIDFormat
+}
+
+// eidCheckChar computes the Luhn mod 36 check character, which catches any
+// single wrong character and most swapped neighbours
+func eidCheckChar(payload string) byte {
+	n := len(eidAlphabet)
+	factor, sum := 2, 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(eidAlphabet, payload[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return eidAlphabet[(n-sum%n)%n]
+}
+
+// EIDFilter matches a canonical EID or the 10-character form an account keeps
+// until MigrateEIDFormat reaches it, or for good if the migration skipped it
+func EIDFilter(eid string) interface{} {
+	if len(eid) != EIDLength {
+		return eid
+	}
+	return bson.M{"$in": bson.A{eid, eid[:eidPayloadLength]}}
+}
+
+// FindUserByEID looks up a canonical EID, falling back to the 10-character form.
+// An account holding the canonical form wins over a legacy one.
+func FindUserByEID(ctx context.Context, users *mongo.Collection, eid string) (models.User, error) {
+	var user models.User
+	err := users.FindOne(ctx, bson.M{"eid": eid}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) && len(eid) == EIDLength {
+		err = users.FindOne(ctx, bson.M{"eid": eid[:eidPayloadLength]}).Decode(&user)
+	}
+	return user, err
+}
+
+// MigrateEIDFormat rewrites stored EIDs into canonical form: lowercase, no
+// separators, with the check character. It only touches EIDs that aren't
+// canonical yet, so it's safe to run at every startup.
+func MigrateEIDFormat(db *mongo.Database) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	users := db.Collection("users")
+	notCanonical := bson.M{"$gt": "", "$not": bson.M{"$regex": "^[0-9a-z]{11}$"}}
+
+	cursor, err := users.Find(ctx, bson.M{"eid": notCanonical})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return migrated, err
+		}
+
+		eid, err := CanonicalEID(user.EID)
+		if err != nil {
+			log.Printf("EID migration: %s has an EID that can't be converted (%q)", user.ID.Hex(), user.EID)
+			continue
+		}
+
+		_, err = users.UpdateOne(ctx, bson.M{"_id": user.ID, "eid": user.EID}, bson.M{"$set": bson.M{"eid": eid}})
+		if mongo.IsDuplicateKeyError(err) {
+			log.Printf("EID migration: %s would collide with another account on %s", user.ID.Hex(), eid)
+			continue
+		} else if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	// retired EIDs are keyed by the EID itself, so swap the documents
+	retired := db.Collection("retired_eids")
+	var old []models.RetiredEID
+	cursor, err = retired.Find(ctx, bson.M{"_id": notCanonical})
+	if err != nil {
+		return migrated, err
+	}
+	if err := cursor.All(ctx, &old); err != nil {
+		return migrated, err
+	}
+	for _, r := range old {
+		eid, err := CanonicalEID(r.EID)
+		if err != nil {
+			continue
+		}
+		_, err = retired.InsertOne(ctx, models.RetiredEID{EID: eid, RetiredAt: r.RetiredAt})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return migrated, err
+		}
+		if _, err := retired.DeleteOne(ctx, bson.M{"_id": r.EID}); err != nil {
+			return migrated, err
+		}
+	}
+
+	return migrated, nil
+}
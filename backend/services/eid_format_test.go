@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testEIDPayloads = []string{"0000000000", "a1b2c3d4e5", "zzzzzzzzzz", "k3v9q0m7x2", "9876543210"}
+
+func TestCanonicalEIDAcceptsItsOwnCheckCharacter(t *testing.T) {
+	for _, payload := range testEIDPayloads {
+		eid := payload + string(eidCheckChar(payload))
+		got, err := CanonicalEID(eid)
+		if err != nil || got != eid {
+			t.Errorf("CanonicalEID(%q) = %q, %v, want %q", eid, got, err, eid)
+		}
+	}
+}
+
+func TestCanonicalEIDRejectsEverySingleTypo(t *testing.T) {
+	for _, payload := range testEIDPayloads {
+		eid := []byte(payload + string(eidCheckChar(payload)))
+		for i := range eid {
+			original := eid[i]
+			for j := 0; j < len(eidAlphabet); j++ {
+				if eidAlphabet[j] == original {
+					continue
+				}
+				eid[i] = eidAlphabet[j]
+				if _, err := CanonicalEID(string(eid)); !errors.Is(err, ErrEIDCheck) {
+					t.Errorf("CanonicalEID(%q) = %v, want ErrEIDCheck", eid, err)
+				}
+			}
+			eid[i] = original
+		}
+	}
+}
+
+func TestCanonicalEIDCompletesLegacyForm(t *testing.T) {
+	for _, payload := range testEIDPayloads {
+		want := payload + string(eidCheckChar(payload))
+		if got, err := CanonicalEID(payload); err != nil || got != want {
+			t.Errorf("CanonicalEID(%q) = %q, %v, want %q", payload, got, err, want)
+		}
+	}
+}
+
+func TestCanonicalEIDNormalizes(t *testing.T) {
+	want := "a1b2c3d4e5" + string(eidCheckChar("a1b2c3d4e5"))
+	for _, input := range []string{
+		"A1B2C3D4E5" + string(eidCheckChar("a1b2c3d4e5")),
+		" a1b2-c3d4-e5" + string(eidCheckChar("a1b2c3d4e5")) + "\n",
+		"A1B2 C3D4 E5",
+	} {
+		if got, err := CanonicalEID(input); err != nil || got != want {
+			t.Errorf("CanonicalEID(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
+
+func TestCanonicalEIDFormatErrors(t *testing.T) {
+	for _, input := range []string{"", "a1b2c3d4e", "a1b2c3d4e5f6", "a1b2c3d4e_", "a1b2c3d4é5"} {
+		if _, err := CanonicalEID(input); !errors.Is(err, ErrEIDFormat) {
+			t.Errorf("CanonicalEID(%q) = %v, want ErrEIDFormat", input, err)
+		}
+	}
+}
+
+func TestEIDFilter(t *testing.T) {
+	eid := "a1b2c3d4e5" + string(eidCheckChar("a1b2c3d4e5"))
+	want := bson.M{"$in": bson.A{eid, "a1b2c3d4e5"}}
+	if got := EIDFilter(eid); !reflect.DeepEqual(got, want) {
+		t.Errorf("EIDFilter(%q) = %v, want %v", eid, got, want)
+	}
+	if got := EIDFilter("a1b2c3d4e5"); got != "a1b2c3d4e5" {
+		t.Errorf("EIDFilter of a 10-character EID = %v, want it unchanged", got)
+	}
+}
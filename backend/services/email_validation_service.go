@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// Email checks for signup. Addresses are stored with a lowercase local part
+// and an ASCII (punycode) domain, so "ana@bücher.de" and
+// "ana@xn--bcher-kva.de" are the same account.
+
+// EmailError carries a stable code the signup screen can switch on
+type EmailError struct {
+	Code    string
+	Message string
+}
+
+func (e *EmailError) Error() string { return e.Message }
+
+var (
+	ErrEmailRequired      = &EmailError{"email_required", "email is required"}
+	ErrEmailSyntax        = &EmailError{"email_syntax", "email address isn't valid"}
+	ErrEmailDomain        = &EmailError{"email_domain_invalid", "email domain isn't valid"}
+	ErrEmailDisposable    = &EmailError{"email_disposable", "disposable email addresses aren't accepted"}
+	ErrEmailUndeliverable = &EmailError{"email_undeliverable", "this email domain doesn't accept mail"}
+)
+
+// localPartChars are the unquoted characters RFC 5322 allows before the @
+const localPartChars = "abcdefghijklmnopqrstuvwxyz0123456789!#$%&'*+-/=?^_`{|}~."
+
+// NormalizeEmail checks the address's syntax and returns it lowercased with
+// the domain in its ASCII form. It does no network lookups.
+func NormalizeEmail(raw string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(raw))
+	if email == "" {
+		return "", ErrEmailRequired
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 {
+		return "", ErrEmailSyntax
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if len(local) > 64 || strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return "", ErrEmailSyntax
+	}
+	for _, r := range local {
+		if !strings.ContainsRune(localPartChars, r) {
+			return "", ErrEmailSyntax
+		}
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil || !strings.Contains(domain, ".") || len(domain) > 253 {
+		return "", ErrEmailDomain
+	}
+
+	email = local + "@" + domain
+	if len(email) > 254 {
+		return "", ErrEmailSyntax
+	}
+	return email, nil
+}
+
+//go:embed disposable_domains.txt
+var bundledDisposableDomains string
+
+var (
+	disposableOnce    sync.Once
+	disposableDomains map[string]bool
+)
+
+// loadDisposableDomains runs on first use, after main has loaded .env. The
+// file named by DISPOSABLE_DOMAINS_FILE adds to the bundled list.
+func loadDisposableDomains() {
+	disposableDomains = map[string]bool{}
+	addDomains := func(scanner *bufio.Scanner) {
+		for scanner.Scan() {
+			line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if domain, err := idna.Lookup.ToASCII(line); err == nil {
+				disposableDomains[domain] = true
+			}
+		}
+	}
+
+	addDomains(bufio.NewScanner(strings.NewReader(bundledDisposableDomains)))
+
+	path := os.Getenv("DISPOSABLE_DOMAINS_FILE")
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to read disposable email domains:", err)
+		return
+	}
+	defer file.Close()
+	addDomains(bufio.NewScanner(file))
+}
+
+// IsDisposableDomain reports whether an ASCII domain, or any domain above it,
+// is on the disposable list
+func IsDisposableDomain(domain string) bool {
+	disposableOnce.Do(loadDisposableDomains)
+
+	for {
+		if disposableDomains[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// MXResolver looks up mail servers. *net.Resolver satisfies it; tests can swap in a fake.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// EmailValidator runs the full signup checks. With no Resolver the MX lookup is skipped.
+type EmailValidator struct {
+	Resolver MXResolver
+}
+
+// NewEmailValidator uses the system resolver unless EMAIL_MX_CHECK is off
+func NewEmailValidator() *EmailValidator {
+	if on, err := strconv.ParseBool(os.Getenv("EMAIL_MX_CHECK")); err == nil && !on {
+		return &EmailValidator{}
+	}
+	return &EmailValidator{Resolver: net.DefaultResolver}
+}
+
+// Validate normalizes the address, refuses disposable domains and checks the
+// domain can receive mail
+func (v *EmailValidator) Validate(ctx context.Context, raw string) (string, error) {
+	email, err := NormalizeEmail(raw)
+	if err != nil {
+		return "", err
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+
+	if IsDisposableDomain(domain) {
+		return "", ErrEmailDisposable
+	}
+
+	if v.Resolver != nil {
+		if err := v.checkMailDomain(ctx, domain); err != nil {
+			return "", err
+		}
+	}
+	return email, nil
+}
+
+// checkMailDomain wants an MX record, or failing that an address record (the
+// implicit MX of RFC 5321). A null MX means the domain takes no mail. DNS
+// trouble other than "no such domain" lets the address through rather than
+// blocking signups.
+func (v *EmailValidator) checkMailDomain(ctx context.Context, domain string) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	records, err := v.Resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		if len(records) == 1 && (records[0].Host == "." || records[0].Host == "") {
+			return ErrEmailUndeliverable
+		}
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		log.Println("MX lookup failed for", domain+":", err)
+		return nil
+	}
+
+	hosts, err := v.Resolver.LookupHost(ctx, domain)
+	if err == nil && len(hosts) > 0 {
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		log.Println("Host lookup failed for", domain+":", err)
+		return nil
+	}
+	return ErrEmailUndeliverable
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
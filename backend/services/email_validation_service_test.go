@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeResolver answers from maps; names it doesn't know are NXDOMAIN
+type fakeResolver struct {
+	mx     map[string][]*net.MX
+	hosts  map[string][]string
+	errors map[string]error
+}
+
+func (r fakeResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	if err, ok := r.errors[name]; ok {
+		return nil, err
+	}
+	if records, ok := r.mx[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if err, ok := r.errors[host]; ok {
+		return nil, err
+	}
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{raw: "  Ana.Silva@Example.COM ", want: "ana.silva@example.com"},
+		{raw: "ana+news@example.com.", want: "ana+news@example.com"},
+		{raw: "ana@Bücher.de", want: "ana@xn--bcher-kva.de"},
+		{raw: "ana@xn--bcher-kva.de", want: "ana@xn--bcher-kva.de"},
+		{raw: "", wantErr: ErrEmailRequired},
+		{raw: "   ", wantErr: ErrEmailRequired},
+		{raw: "ana.example.com", wantErr: ErrEmailSyntax},
+		{raw: "@example.com", wantErr: ErrEmailSyntax},
+		{raw: "ana@", wantErr: ErrEmailSyntax},
+		{raw: ".ana@example.com", wantErr: ErrEmailSyntax},
+		{raw: "ana.@example.com", wantErr: ErrEmailSyntax},
+		{raw: "an..a@example.com", wantErr: ErrEmailSyntax},
+		{raw: "an a@example.com", wantErr: ErrEmailSyntax},
+		{raw: "anä@example.com", wantErr: ErrEmailSyntax},
+		{raw: strings.Repeat("a", 65) + "@example.com", wantErr: ErrEmailSyntax},
+		{raw: "ana@localhost", wantErr: ErrEmailDomain},
+		{raw: "ana@exa_mple.com", wantErr: ErrEmailDomain},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.raw)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NormalizeEmail(%q) = %q, %v, want %v", tt.raw, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestIsDisposableDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "10minutemail.com", want: true},
+		{domain: "mx.10minutemail.com", want: true},
+		{domain: "a.b.discard.email", want: true},
+		{domain: "not10minutemail.com", want: false},
+		{domain: "gmail.com", want: false},
+		{domain: "example.org", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsDisposableDomain(tt.domain); got != tt.want {
+			t.Errorf("IsDisposableDomain(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMailDomain(t *testing.T) {
+	v := &EmailValidator{Resolver: fakeResolver{
+		mx: map[string][]*net.MX{
+			"mail.example":    {{Host: "mx1.mail.example.", Pref: 10}},
+			"nullmx.example":  {{Host: ".", Pref: 0}},
+			"emptymx.example": {{Host: "", Pref: 0}},
+		},
+		hosts: map[string][]string{
+			"implicit.example": {"192.0.2.10"},
+		},
+		errors: map[string]error{
+			"flaky.example": &net.DNSError{Err: "server misbehaving", Name: "flaky.example", IsTemporary: true},
+		},
+	}}
+
+	tests := []struct {
+		domain  string
+		wantErr error
+	}{
+		{domain: "mail.example"},
+		{domain: "nullmx.example", wantErr: ErrEmailUndeliverable},
+		{domain: "emptymx.example", wantErr: ErrEmailUndeliverable},
+		{domain: "implicit.example"},
+		{domain: "nxdomain.example", wantErr: ErrEmailUndeliverable},
+		{domain: "flaky.example"},
+	}
+
+	for _, tt := range tests {
+		if err := v.checkMailDomain(context.Background(), tt.domain); !errors.Is(err, tt.wantErr) {
+			t.Errorf("checkMailDomain(%q) = %v, want %v", tt.domain, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEmailValidatorValidate(t *testing.T) {
+	ctx := context.Background()
+	v := &EmailValidator{Resolver: fakeResolver{
+		mx: map[string][]*net.MX{"mail.example": {{Host: "mx1.mail.example.", Pref: 10}}},
+	}}
+
+	if got, err := v.Validate(ctx, "Ana@Mail.Example"); err != nil || got != "ana@mail.example" {
+		t.Errorf("Validate = %q, %v, want ana@mail.example", got, err)
+	}
+	if _, err := v.Validate(ctx, "ana@10minutemail.com"); !errors.Is(err, ErrEmailDisposable) {
+		t.Errorf("Validate of a disposable address = %v, want ErrEmailDisposable", err)
+	}
+	if _, err := v.Validate(ctx, "ana@nxdomain.example"); !errors.Is(err, ErrEmailUndeliverable) {
+		t.Errorf("Validate of an unknown domain = %v, want ErrEmailUndeliverable", err)
+	}
+
+	// without a resolver only the offline checks run
+	offline := &EmailValidator{}
+	if got, err := offline.Validate(ctx, "ana@nxdomain.example"); err != nil || got != "ana@nxdomain.example" {
+		t.Errorf("Validate without a resolver = %q, %v, want the address accepted", got, err)
+	}
+	if _, err := offline.Validate(ctx, "ana@mx.10minutemail.com"); !errors.Is(err, ErrEmailDisposable) {
+		t.Errorf("Validate without a resolver of a disposable address = %v, want ErrEmailDisposable", err)
+	}
+}
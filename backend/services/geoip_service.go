@@ -0,0 +1,56 @@
+package services
+
+import (
+	"log"
+	"net"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var (
+	geoIPReader *geoip2.Reader
+	geoIPMu     sync.RWMutex
+)
+
+// InitGeoIP opens the local MaxMind/DB-IP country database (MMDB).
+// Without it every lookup returns an empty country code.
+func InitGeoIP(path string) error {
+	if path == "" {
+		log.Println("GEOIP_DB_PATH not set, sign-in risk scoring will run without location")
+		return nil
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+
+	geoIPMu.Lock()
+	defer geoIPMu.Unlock()
+	if geoIPReader != nil {
+		geoIPReader.Close()
+	}
+	geoIPReader = reader
+	return nil
+}
+
+// LookupCountry returns the ISO country code for an IP, or "" when unknown
+func LookupCountry(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	geoIPMu.RLock()
+	defer geoIPMu.RUnlock()
+	if geoIPReader == nil {
+		return ""
+	}
+
+	record, err := geoIPReader.Country(parsed)
+	if err != nil {
+		return ""
+	}
+	return record.Country.IsoCode
+}
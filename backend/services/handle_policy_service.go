@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rules for public @handles. Format checks live in NormalizeHandle; these
+// decide which well-formed handles can actually be claimed.
+
+var (
+	ErrHandleReserved = errors.New("this handle is reserved")
+	ErrHandleProfane  = errors.New("this handle isn't allowed")
+	ErrHandleDots     = errors.New("handle can't start or end with a dot or have two dots in a row")
+	ErrHandleLikeEID  = errors.New("handle can't look like an EID")
+)
+
+// reservedHandles could be mistaken for the service itself or its staff
+var reservedHandles = map[string]bool{
+	"admin": true, "administrator": true, "root": true, "system": true, "support": true,
+	"help": true, "helpdesk": true, "security": true, "official": true, "staff": true,
+	"team": true, "egoty": true, "moderator": true, "mod": true, "billing": true,
+	"payments": true, "pay": true, "wallet": true, "bank": true, "api": true,
+	"www": true, "mail": true, "noreply": true, "no_reply": true, "info": true,
+	"account": true, "accounts": true, "login": true, "signin": true, "signup": true,
+	"register": true, "settings": true, "null": true, "undefined": true,
+}
+
+// profaneWords are refused anywhere inside a handle. HANDLE_BLOCKLIST_FILE can
+// add more, one word per line.
+var profaneWords = []string{
+	"fuck", "shit", "cunt", "bitch", "bastard", "pussy", "dildo", "wank",
+	"whore", "slut", "nigger", "nigga", "faggot", "nazi",
+}
+
+var loadBlocklistOnce sync.Once
+
+// loadHandleBlocklist runs on first use, after main has loaded .env
+func loadHandleBlocklist() {
+	path := os.Getenv("HANDLE_BLOCKLIST_FILE")
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to read handle blocklist:", err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.ToLower(strings.TrimSpace(scanner.Text())); word != "" && !strings.HasPrefix(word, "#") {
+			profaneWords = append(profaneWords, word)
+		}
+	}
+}
+
+// HandleRenameCooldown reads HANDLE_RENAME_COOLDOWN_DAYS, defaulting to 30 days
+func HandleRenameCooldown() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("HANDLE_RENAME_COOLDOWN_DAYS"))
+	if err != nil || days < 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ValidateNewHandle normalizes a handle the user wants to claim and checks it
+// against the format, reserved and blocked word rules
+func ValidateNewHandle(raw string) (string, error) {
+	loadBlocklistOnce.Do(loadHandleBlocklist)
+
+	handle, err := NormalizeHandle(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(handle, ".") || strings.HasSuffix(handle, ".") || strings.Contains(handle, "..") {
+		return "", ErrHandleDots
+	}
+
+	// the public lookup accepts both, so a handle must never read as a checked EID
+	if _, err := CanonicalEID(handle); err == nil && len(handle) == EIDLength {
+		return "", ErrHandleLikeEID
+	}
+
+	if reservedHandles[strings.ReplaceAll(handle, ".", "")] {
+		return "", ErrHandleReserved
+	}
+
+	squashed := strings.NewReplacer(".", "", "_", "", "0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t").Replace(handle)
+	for _, word := range profaneWords {
+		if strings.Contains(squashed, word) {
+			return "", ErrHandleProfane
+		}
+	}
+	return handle, nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"flutter_project_backend/models"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Sign-in and recovery flows accept one "identifier" field. It can be an email,
+// an EID, an E.164 phone number (leading + required, so an all-digit EID isn't
+// mistaken for a phone) or an @handle.
+
+const (
+	IdentifierEmail  = "email"
+	IdentifierEID    = "eid"
+	IdentifierPhone  = "phone"
+	IdentifierHandle = "handle"
+)
+
+var (
+	ErrIdentifierRequired = errors.New("EID, email, phone or @handle is required")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrInvalidPhone       = errors.New("phone number must be in international format, like +14155550123")
+	ErrInvalidHandle      = errors.New("invalid handle")
+	ErrAccountNotFound    = errors.New("account not found")
+)
+
+var (
+	e164Pattern   = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	handlePattern = regexp.MustCompile(`^[a-z0-9_.]{3,20}$`)
+)
+
+// Identifier is a classified, normalized identifier
+type Identifier struct {
+	Kind  string
+	Value string
+}
+
+// NotFoundError says no account matches the identifier. It matches ErrAccountNotFound.
+type NotFoundError struct {
+	Kind string
+}
+
+func (e *NotFoundError) Error() string {
+	switch e.Kind {
+	case IdentifierEmail:
+		return "email not registered"
+	case IdentifierPhone:
+		return "phone number not registered"
+	case IdentifierHandle:
+		return "handle not registered"
+	}
+	return "EID not registered"
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrAccountNotFound
+}
+
+// NormalizePhone strips the usual separators from a phone number and checks it's E.164
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+	if !e164Pattern.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
+}
+
+// NormalizeHandle lowercases a handle and drops the leading @
+func NormalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+	if !handlePattern.MatchString(handle) {
+		return "", ErrInvalidHandle
+	}
+	return handle, nil
+}
+
+// ClassifyIdentifier works out what kind of identifier the user typed and normalizes it
+func ClassifyIdentifier(raw string) (Identifier, error) {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "":
+		return Identifier{}, ErrIdentifierRequired
+
+	case strings.HasPrefix(raw, "@"):
+		handle, err := NormalizeHandle(raw)
+		return Identifier{Kind: IdentifierHandle, Value: handle}, err
+
+	case strings.Contains(raw, "@"):
+		if email, err := NormalizeEmail(raw); err == nil {
+			return Identifier{Kind: IdentifierEmail, Value: email}, nil
+		}
+		// accounts from before signup validation may not pass it, so only
+		// the basic shape is required to sign in
+		email := strings.ToLower(raw)
+		if at := strings.LastIndex(email, "@"); at < 1 || at == len(email)-1 {
+			return Identifier{}, ErrInvalidEmail
+		}
+		return Identifier{Kind: IdentifierEmail, Value: email}, nil
+
+	case strings.HasPrefix(raw, "+"):
+		phone, err := NormalizePhone(raw)
+		return Identifier{Kind: IdentifierPhone, Value: phone}, err
+	}
+
+	eid, err := CanonicalEID(raw)
+	return Identifier{Kind: IdentifierEID, Value: eid}, err
+}
+
+// IdentifierResolver finds the account behind an identifier
+type IdentifierResolver struct {
+	Users *mongo.Collection
+}
+
+// Resolve returns the user, or a *NotFoundError when no account matches.
+// Malformed input fails with the classification error before any query.
+func (r IdentifierResolver) Resolve(ctx context.Context, raw string) (models.User, Identifier, error) {
+	var user models.User
+
+	id, err := ClassifyIdentifier(raw)
+	if err != nil {
+		return user, id, err
+	}
+
+	if id.Kind == IdentifierEID {
+		user, err = FindUserByEID(ctx, r.Users, id.Value)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return user, id, &NotFoundError{Kind: id.Kind}
+		}
+		return user, id, err
+	}
+
+	err = r.Users.FindOne(ctx, bson.M{id.Kind: id.Value}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, id, &NotFoundError{Kind: id.Kind}
+	}
+	return user, id, err
+}
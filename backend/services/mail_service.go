@@ -3,9 +3,11 @@ package services
 import (
 	"bytes"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 )
 
 // SendEmail sends an email using Mailgun API
@@ -49,3 +51,20 @@ func SendEmail(toEmail, subject, htmlContent string) error {
 
 	return nil
 }
+
+// QueueEmail sends in the background, retrying a few times with backoff.
+// Use it where the caller must not wait on (or fail because of) Mailgun.
+func QueueEmail(toEmail, subject, htmlContent string) {
+	go func() {
+		delay := 2 * time.Second
+		for attempt := 1; attempt <= 3; attempt++ {
+			err := SendEmail(toEmail, subject, htmlContent)
+			if err == nil {
+				return
+			}
+			log.Printf("Queued email to %s failed (attempt %d): %v", toEmail, attempt, err)
+			time.Sleep(delay)
+			delay *= 4
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Adaptive proof-of-work difficulty. Challenges start at POW_DIFFICULTY and get
+// harder while this instance hands out more than POW_LOAD_THRESHOLD per minute
+// (one extra bit each time the rate doubles), and for IPs that have recently
+// hit rate limits or sent bad solutions (two bits per strike, strikes halving
+// every ten minutes).
+
+const (
+	powMaxDifficulty     = 30
+	powMaxLoadBits       = 6
+	powMaxSuspicionBits  = 8
+	powSuspicionHalfLife = 10 * time.Minute
+)
+
+// PowLoadThreshold reads POW_LOAD_THRESHOLD, challenges per minute before
+// difficulty rises, defaulting to 120
+func PowLoadThreshold() int {
+	n, err := strconv.Atoi(os.Getenv("POW_LOAD_THRESHOLD"))
+	if err != nil || n < 1 {
+		return 120
+	}
+	return n
+}
+
+// PowRequired reads POW_REQUIRED. The code-sending endpoints need a proof of
+// work unless it's set to false.
+func PowRequired() bool {
+	on, err := strconv.ParseBool(os.Getenv("POW_REQUIRED"))
+	return err != nil || on
+}
+
+var powDemand = &powLoadTracker{}
+
+// powLoadTracker counts challenges over the last minute in one-second slots
+type powLoadTracker struct {
+	mu    sync.Mutex
+	slots [60]struct {
+		second int64
+		count  int
+	}
+}
+
+func (t *powLoadTracker) record(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sec := now.Unix()
+	slot := &t.slots[sec%60]
+	if slot.second != sec {
+		slot.second, slot.count = sec, 0
+	}
+	slot.count++
+}
+
+func (t *powLoadTracker) perMinute(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := 0
+	for _, slot := range t.slots {
+		if now.Unix()-slot.second < 60 {
+			total += slot.count
+		}
+	}
+	return total
+}
+
+var powSuspects = &suspicionTracker{scores: map[string]suspicion{}}
+
+// suspicionTracker keeps a decaying strike count per IP
+type suspicionTracker struct {
+	mu     sync.Mutex
+	scores map[string]suspicion
+}
+
+type suspicion struct {
+	score   float64
+	updated time.Time
+}
+
+func decayed(s suspicion, now time.Time) float64 {
+	return s.score * math.Pow(0.5, now.Sub(s.updated).Seconds()/powSuspicionHalfLife.Seconds())
+}
+
+func (t *suspicionTracker) strike(ip string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.scores) > 10000 {
+		for key, s := range t.scores {
+			if decayed(s, now) < 0.5 {
+				delete(t.scores, key)
+			}
+		}
+	}
+	t.scores[ip] = suspicion{score: decayed(t.scores[ip], now) + 1, updated: now}
+}
+
+func (t *suspicionTracker) score(ip string, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.scores[ip]
+	if !ok {
+		return 0
+	}
+	return decayed(s, now)
+}
+
+// FlagSuspiciousIP adds a strike against an IP, making its next challenges harder
+func FlagSuspiciousIP(ip string) {
+	if ip != "" {
+		powSuspects.strike(ip, time.Now())
+	}
+}
+
+// PowDifficultyFor is the difficulty for the next challenge handed to this IP.
+// Each call counts towards the load.
+func PowDifficultyFor(ip string) int {
+	now := time.Now()
+	powDemand.record(now)
+
+	difficulty := PowDifficulty()
+
+	if rate, threshold := powDemand.perMinute(now), PowLoadThreshold(); rate > threshold {
+		difficulty += min(int(math.Log2(float64(rate)/float64(threshold)))+1, powMaxLoadBits)
+	}
+
+	// rounded, since a strike starts decaying the moment it's made
+	difficulty += min(2*int(math.Round(powSuspects.score(ip, now))), powMaxSuspicionBits)
+
+	return min(difficulty, powMaxDifficulty)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// resetPowTrackers gives a test fresh load and suspicion state
+func resetPowTrackers(t *testing.T) {
+	t.Helper()
+	demand, suspects := powDemand, powSuspects
+	powDemand = &powLoadTracker{}
+	powSuspects = &suspicionTracker{scores: map[string]suspicion{}}
+	t.Cleanup(func() { powDemand, powSuspects = demand, suspects })
+}
+
+func TestPowRequiredDefaultsOn(t *testing.T) {
+	t.Setenv("POW_REQUIRED", "")
+	if !PowRequired() {
+		t.Fatal("PowRequired() = false with POW_REQUIRED unset")
+	}
+	t.Setenv("POW_REQUIRED", "false")
+	if PowRequired() {
+		t.Fatal("PowRequired() = true with POW_REQUIRED=false")
+	}
+}
+
+func TestPowDifficultyForBase(t *testing.T) {
+	resetPowTrackers(t)
+	t.Setenv("POW_DIFFICULTY", "")
+
+	if got := PowDifficultyFor("192.0.2.1"); got != 18 {
+		t.Fatalf("PowDifficultyFor = %d, want the default 18", got)
+	}
+
+	t.Setenv("POW_DIFFICULTY", "12")
+	if got := PowDifficultyFor("192.0.2.1"); got != 12 {
+		t.Fatalf("PowDifficultyFor = %d, want POW_DIFFICULTY 12", got)
+	}
+}
+
+func TestPowDifficultyForLoad(t *testing.T) {
+	t.Setenv("POW_DIFFICULTY", "10")
+	t.Setenv("POW_LOAD_THRESHOLD", "10")
+
+	tests := []struct {
+		earlier int // challenges already handed out this minute
+		want    int
+	}{
+		{earlier: 9, want: 10},   // 10 a minute, at the threshold
+		{earlier: 10, want: 11},  // just over
+		{earlier: 19, want: 12},  // twice the threshold
+		{earlier: 39, want: 13},  // four times
+		{earlier: 999, want: 16}, // capped at six extra bits
+	}
+
+	for _, tt := range tests {
+		resetPowTrackers(t)
+		now := time.Now()
+		for i := 0; i < tt.earlier; i++ {
+			powDemand.record(now)
+		}
+		if got := PowDifficultyFor("192.0.2.1"); got != tt.want {
+			t.Errorf("after %d challenges PowDifficultyFor = %d, want %d", tt.earlier, got, tt.want)
+		}
+	}
+}
+
+func TestPowDifficultyForSuspiciousIP(t *testing.T) {
+	resetPowTrackers(t)
+	t.Setenv("POW_DIFFICULTY", "10")
+	t.Setenv("POW_LOAD_THRESHOLD", "1000")
+
+	FlagSuspiciousIP("192.0.2.1")
+	if got := PowDifficultyFor("192.0.2.1"); got != 12 {
+		t.Fatalf("after one strike PowDifficultyFor = %d, want 12", got)
+	}
+	if got := PowDifficultyFor("192.0.2.2"); got != 10 {
+		t.Fatalf("another IP got %d, want 10", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		FlagSuspiciousIP("192.0.2.1")
+	}
+	if got := PowDifficultyFor("192.0.2.1"); got != 18 {
+		t.Fatalf("after many strikes PowDifficultyFor = %d, want 10 plus the 8-bit cap", got)
+	}
+}
+
+func TestPowDifficultyForCap(t *testing.T) {
+	resetPowTrackers(t)
+	t.Setenv("POW_DIFFICULTY", "28")
+	t.Setenv("POW_LOAD_THRESHOLD", "1000")
+
+	for i := 0; i < 10; i++ {
+		FlagSuspiciousIP("192.0.2.1")
+	}
+	if got := PowDifficultyFor("192.0.2.1"); got != powMaxDifficulty {
+		t.Fatalf("PowDifficultyFor = %d, want the cap %d", got, powMaxDifficulty)
+	}
+}
+
+func TestSuspicionDecays(t *testing.T) {
+	tracker := &suspicionTracker{scores: map[string]suspicion{}}
+	now := time.Now()
+
+	tracker.strike("192.0.2.1", now)
+	tracker.strike("192.0.2.1", now)
+	if got := tracker.score("192.0.2.1", now.Add(powSuspicionHalfLife)); got < 0.99 || got > 1.01 {
+		t.Fatalf("two strikes after one half-life = %.2f, want 1", got)
+	}
+}
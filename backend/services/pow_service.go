@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Hashcash-style proof of work. The server hands out a signed challenge naming
+// a scope and a difficulty; the client finds a solution such that
+// sha256(challenge + ":" + solution) starts with that many zero bits. Each
+// challenge can be redeemed once.
+
+const (
+	powPurpose      = "pow"
+	PowChallengeTTL = 2 * time.Minute
+)
+
+var (
+	ErrPowRequired = errors.New("proof of work required")
+	ErrPowInvalid  = errors.New("invalid or expired proof of work")
+	ErrPowReused   = errors.New("proof of work already used")
+)
+
+// PowDifficulty reads POW_DIFFICULTY, the leading zero bits required, defaulting to 18
+func PowDifficulty() int {
+	n, err := strconv.Atoi(os.Getenv("POW_DIFFICULTY"))
+	if err != nil || n < 1 || n > 32 {
+		return 18
+	}
+	return n
+}
+
+// IssuePowChallenge signs a challenge for one scope (usually the endpoint) and difficulty
+func IssuePowChallenge(scope string, difficulty int) (string, error) {
+	nonce, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	return SignToken(powPurpose, fmt.Sprintf("%s|%d|%s", scope, difficulty, nonce), PowChallengeTTL), nil
+}
+
+// PowRedemptions remembers redeemed challenges until they expire. Redeem
+// returns ErrPowReused for a challenge it has already seen.
+type PowRedemptions interface {
+	Redeem(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+// MongoPowRedemptions keeps redeemed challenges in pow_redeemed, shared by all instances
+type MongoPowRedemptions struct {
+	Collection *mongo.Collection
+}
+
+func (r *MongoPowRedemptions) Redeem(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := r.Collection.InsertOne(ctx, bson.M{"_id": id, "expiresAt": expiresAt})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPowReused
+	}
+	return err
+}
+
+// PowVerifier checks solutions and redeems each challenge once
+type PowVerifier struct {
+	Used PowRedemptions
+}
+
+// SetupPowIndexes drops redeemed challenges once they'd have expired anyway
+func SetupPowIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println("Failed to create proof-of-work indexes:", err)
+	}
+}
+
+// Verify checks the solution meets the challenge's difficulty for this scope and
+// redeems the challenge
+func (v *PowVerifier) Verify(ctx context.Context, scope, challenge, solution string) error {
+	if challenge == "" || solution == "" {
+		return ErrPowRequired
+	}
+
+	payload, err := VerifyToken(powPurpose, challenge)
+	if err != nil {
+		return ErrPowInvalid
+	}
+	parts := strings.SplitN(payload, "|", 3)
+	if len(parts) != 3 || parts[0] != scope {
+		return ErrPowInvalid
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil || leadingZeroBits(challenge, solution) < difficulty {
+		return ErrPowInvalid
+	}
+
+	return v.Used.Redeem(ctx, HashToken(challenge), time.Now().Add(PowChallengeTTL))
+}
+
+func leadingZeroBits(challenge, solution string) int {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	zeros := 0
+	for _, b := range sum {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryPowRedemptions is a PowRedemptions for tests
+type memoryPowRedemptions map[string]time.Time
+
+func (m memoryPowRedemptions) Redeem(_ context.Context, id string, expiresAt time.Time) error {
+	if _, ok := m[id]; ok {
+		return ErrPowReused
+	}
+	m[id] = expiresAt
+	return nil
+}
+
+func solvePow(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	for i := 0; i < 1<<24; i++ {
+		solution := strconv.Itoa(i)
+		if leadingZeroBits(challenge, solution) >= difficulty {
+			return solution
+		}
+	}
+	t.Fatalf("no solution found for difficulty %d", difficulty)
+	return ""
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte("challenge:" + solution))
+
+		var bitString strings.Builder
+		for _, b := range sum {
+			fmt.Fprintf(&bitString, "%08b", b)
+		}
+		want := strings.Index(bitString.String(), "1")
+		if want < 0 {
+			want = 256
+		}
+
+		if got := leadingZeroBits("challenge", solution); got != want {
+			t.Fatalf("leadingZeroBits(challenge, %s) = %d, want %d", solution, got, want)
+		}
+	}
+}
+
+func TestPowVerifierVerify(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	ctx := context.Background()
+
+	challenge, err := IssuePowChallenge("get-code", 8)
+	if err != nil {
+		t.Fatalf("IssuePowChallenge: %v", err)
+	}
+	solution := solvePow(t, challenge, 8)
+
+	t.Run("missing", func(t *testing.T) {
+		v := &PowVerifier{Used: memoryPowRedemptions{}}
+		if err := v.Verify(ctx, "get-code", "", ""); !errors.Is(err, ErrPowRequired) {
+			t.Fatalf("Verify with no headers = %v, want ErrPowRequired", err)
+		}
+	})
+
+	t.Run("other scope", func(t *testing.T) {
+		v := &PowVerifier{Used: memoryPowRedemptions{}}
+		if err := v.Verify(ctx, "check-eid", challenge, solution); !errors.Is(err, ErrPowInvalid) {
+			t.Fatalf("Verify for another scope = %v, want ErrPowInvalid", err)
+		}
+	})
+
+	t.Run("too few zero bits", func(t *testing.T) {
+		v := &PowVerifier{Used: memoryPowRedemptions{}}
+		wrong := solution
+		for leadingZeroBits(challenge, wrong) >= 8 {
+			wrong += "x"
+		}
+		if err := v.Verify(ctx, "get-code", challenge, wrong); !errors.Is(err, ErrPowInvalid) {
+			t.Fatalf("Verify with a weak solution = %v, want ErrPowInvalid", err)
+		}
+	})
+
+	t.Run("tampered challenge", func(t *testing.T) {
+		v := &PowVerifier{Used: memoryPowRedemptions{}}
+		if err := v.Verify(ctx, "get-code", challenge+"0", solution); !errors.Is(err, ErrPowInvalid) {
+			t.Fatalf("Verify with a tampered challenge = %v, want ErrPowInvalid", err)
+		}
+	})
+
+	t.Run("redeemed once", func(t *testing.T) {
+		v := &PowVerifier{Used: memoryPowRedemptions{}}
+		if err := v.Verify(ctx, "get-code", challenge, solution); err != nil {
+			t.Fatalf("first Verify = %v, want nil", err)
+		}
+		if err := v.Verify(ctx, "get-code", challenge, solution); !errors.Is(err, ErrPowReused) {
+			t.Fatalf("second Verify = %v, want ErrPowReused", err)
+		}
+	})
+}
+
+func TestPowVerifierRejectsOtherPurposes(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	// a valid token signed for something else isn't a challenge
+	token := SignToken("magic_link", "get-code|1|nonce", PowChallengeTTL)
+	v := &PowVerifier{Used: memoryPowRedemptions{}}
+	if err := v.Verify(context.Background(), "get-code", token, solvePow(t, token, 1)); !errors.Is(err, ErrPowInvalid) {
+		t.Fatalf("Verify with a token for another purpose = %v, want ErrPowInvalid", err)
+	}
+}
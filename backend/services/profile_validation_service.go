@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrNameRequired = errors.New("is required")
+	ErrNameTooLong  = errors.New("must be at most 50 characters")
+	ErrNameInvalid  = errors.New("may only contain letters, spaces, hyphens and apostrophes")
+	ErrDOBFormat    = errors.New("must be a date in YYYY-MM-DD format")
+	ErrDOBFuture    = errors.New("can't be in the future")
+	ErrDOBTooOld    = errors.New("is not a realistic date of birth")
+	ErrGenderValue  = errors.New("must be one of male, female, other, prefer_not_to_say")
+	ErrAvatarURL    = errors.New("must be an https URL of at most 512 characters")
+)
+
+var Genders = []string{"male", "female", "other", "prefer_not_to_say"}
+
+// MinUserAge reads MIN_USER_AGE. Unset or 0 means there's no minimum age.
+func MinUserAge() int {
+	age, err := strconv.Atoi(os.Getenv("MIN_USER_AGE"))
+	if err != nil || age < 0 {
+		return 0
+	}
+	return age
+}
+
+// NormalizeName trims a first or last name and checks it
+func NormalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrNameRequired
+	}
+	if len([]rune(name)) > 50 {
+		return "", ErrNameTooLong
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsMark(r) && r != ' ' && r != '-' && r != '\'' {
+			return "", ErrNameInvalid
+		}
+	}
+	return name, nil
+}
+
+// NormalizeGender lowercases the value and checks it against Genders
+func NormalizeGender(gender string) (string, error) {
+	gender = strings.ToLower(strings.TrimSpace(gender))
+	for _, g := range Genders {
+		if g == gender {
+			return gender, nil
+		}
+	}
+	return "", ErrGenderValue
+}
+
+// ParseDateOfBirth parses a YYYY-MM-DD date and applies the age rules: not in
+// the future, no more than 120 years ago and, when MIN_USER_AGE is set, at
+// least that many years ago
+func ParseDateOfBirth(value string) (time.Time, error) {
+	dob, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, ErrDOBFormat
+	}
+
+	now := time.Now().UTC()
+	if dob.After(now) {
+		return time.Time{}, ErrDOBFuture
+	}
+	if dob.Before(now.AddDate(-120, 0, 0)) {
+		return time.Time{}, ErrDOBTooOld
+	}
+	if minAge := MinUserAge(); minAge > 0 && dob.After(now.AddDate(-minAge, 0, 0)) {
+		return time.Time{}, errors.New("you must be at least " + strconv.Itoa(minAge) + " years old")
+	}
+	return dob, nil
+}
+
+// NormalizeAvatarURL checks an avatar link; an empty one removes the avatar
+func NormalizeAvatarURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" || len(raw) > 512 {
+		return "", ErrAvatarURL
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,384 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Token-bucket rate limiting. Each rule gives a route a bucket per IP, per
+// identifier (the email or EID in the request body) or per signed-in user.
+// A bucket holds Limit tokens and refills evenly over Per.
+
+const (
+	RateLimitByIP         = "ip"
+	RateLimitByIdentifier = "identifier"
+	RateLimitByUser       = "user"
+)
+
+// RateLimitRule is one bucket for a route
+type RateLimitRule struct {
+	Key   string        `json:"key"`
+	Limit int           `json:"limit"`
+	Per   time.Duration `json:"-"`
+}
+
+// refillRate is tokens per second
+func (r RateLimitRule) refillRate() float64 {
+	return float64(r.Limit) / r.Per.Seconds()
+}
+
+// UnmarshalJSON reads "per" as a Go duration such as "10m"
+func (r *RateLimitRule) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Key   string `json:"key"`
+		Limit int    `json:"limit"`
+		Per   string `json:"per"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	per, err := time.ParseDuration(raw.Per)
+	if err != nil {
+		return fmt.Errorf("rate limit %q: %w", raw.Per, err)
+	}
+	if raw.Key != RateLimitByIP && raw.Key != RateLimitByIdentifier && raw.Key != RateLimitByUser {
+		return fmt.Errorf("rate limit key must be ip, identifier or user, not %q", raw.Key)
+	}
+	if raw.Limit < 1 || per <= 0 {
+		return fmt.Errorf("rate limit needs a positive limit and period")
+	}
+	*r = RateLimitRule{Key: raw.Key, Limit: raw.Limit, Per: per}
+	return nil
+}
+
+// defaultRateLimits apply unless RATE_LIMIT_CONFIG overrides a route.
+// Routes are "METHOD /path" as registered with gin.
+var defaultRateLimits = map[string][]RateLimitRule{
+	"POST /get-code": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /get-code-sign-in": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /send-reset-code": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /send-eid-code": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /magic-link/request": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /account/unfreeze/send-code": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /account/unfreeze": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /forgot-eid": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 3, Per: 10 * time.Minute},
+	},
+	"POST /sign-in": {
+		{Key: RateLimitByIP, Limit: 30, Per: 5 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 5 * time.Minute},
+	},
+	"POST /validate-credentials": {
+		{Key: RateLimitByIP, Limit: 30, Per: 5 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 5 * time.Minute},
+	},
+	"POST /reset-password": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /validate-pin": {
+		{Key: RateLimitByUser, Limit: 5, Per: 5 * time.Minute},
+	},
+	"POST /validate-pattern": {
+		{Key: RateLimitByUser, Limit: 5, Per: 5 * time.Minute},
+	},
+	"POST /check-eid": {
+		{Key: RateLimitByIP, Limit: 10, Per: time.Minute},
+	},
+	"POST /check-handle": {
+		{Key: RateLimitByIP, Limit: 30, Per: time.Minute},
+	},
+	"GET /users/lookup/:identifier": {
+		{Key: RateLimitByIP, Limit: 30, Per: time.Minute},
+	},
+	"POST /send-sms-code": {
+		{Key: RateLimitByIP, Limit: 10, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 3, Per: 10 * time.Minute},
+	},
+	"POST /security/phone": {
+		{Key: RateLimitByUser, Limit: 5, Per: time.Hour},
+	},
+	"POST /security/phone/verify": {
+		{Key: RateLimitByUser, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /pow/challenge": {
+		{Key: RateLimitByIP, Limit: 60, Per: time.Minute},
+	},
+	"POST /verify-code": {
+		{Key: RateLimitByIP, Limit: 30, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /verify-code-sign-in": {
+		{Key: RateLimitByIP, Limit: 30, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /verify-reset-code": {
+		{Key: RateLimitByIP, Limit: 30, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /verify-eid-code": {
+		{Key: RateLimitByIP, Limit: 30, Per: 10 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /security/step-up/send-code": {
+		{Key: RateLimitByUser, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /account/delete/send-code": {
+		{Key: RateLimitByUser, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /account/delete": {
+		{Key: RateLimitByUser, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /change-password": {
+		{Key: RateLimitByUser, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /change-pin": {
+		{Key: RateLimitByUser, Limit: 5, Per: 10 * time.Minute},
+	},
+	"POST /device-keys/challenge": {
+		{Key: RateLimitByIP, Limit: 30, Per: 5 * time.Minute},
+		{Key: RateLimitByIdentifier, Limit: 10, Per: 5 * time.Minute},
+	},
+	"POST /device-keys/sign-in": {
+		{Key: RateLimitByIP, Limit: 30, Per: 5 * time.Minute},
+	},
+	"POST /qr-login/requests": {
+		{Key: RateLimitByIP, Limit: 20, Per: 10 * time.Minute},
+	},
+	"GET /qr-login/requests/:id/wait": {
+		{Key: RateLimitByIP, Limit: 60, Per: time.Minute},
+	},
+	"GET /qr-login/requests/:id": {
+		{Key: RateLimitByUser, Limit: 30, Per: time.Minute},
+	},
+	"POST /qr-login/requests/:id/approve": {
+		{Key: RateLimitByUser, Limit: 10, Per: 10 * time.Minute},
+	},
+	"POST /qr-login/requests/:id/deny": {
+		{Key: RateLimitByUser, Limit: 10, Per: 10 * time.Minute},
+	},
+}
+
+// LoadRateLimitRules starts from the defaults and lets the JSON file named by
+// RATE_LIMIT_CONFIG replace the rules of any route, e.g.
+//
+//	{"POST /sign-in": [{"key": "ip", "limit": 30, "per": "5m"}]}
+//
+// An empty list switches limiting off for that route.
+func LoadRateLimitRules() (map[string][]RateLimitRule, error) {
+	rules := make(map[string][]RateLimitRule, len(defaultRateLimits))
+	for route, list := range defaultRateLimits {
+		rules[route] = list
+	}
+
+	path := os.Getenv("RATE_LIMIT_CONFIG")
+	if path == "" {
+		return rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	var overrides map[string][]RateLimitRule
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return rules, err
+	}
+	for route, list := range overrides {
+		rules[route] = list
+	}
+	return rules, nil
+}
+
+// RateLimitResult is the state of one bucket after taking a token
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// RateLimitStore keeps buckets. Take must be atomic per key.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rule RateLimitRule, now time.Time) (RateLimitResult, error)
+}
+
+func bucketResult(tokens float64, allowed bool, rule RateLimitRule) RateLimitResult {
+	rate := rule.refillRate()
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(rule.Limit) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// MemoryRateLimitStore keeps buckets in this process only
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, rule RateLimitRule, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		// buckets that have refilled are the same as missing ones, so drop them now and then
+		if len(s.buckets) > 10000 {
+			for k, old := range s.buckets {
+				if now.After(old.full) {
+					delete(s.buckets, k)
+				}
+			}
+		}
+		b = &memoryBucket{tokens: float64(rule.Limit), updated: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := max(now.Sub(b.updated).Seconds(), 0)
+	b.tokens = min(float64(rule.Limit), b.tokens+elapsed*rule.refillRate())
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := bucketResult(b.tokens, allowed, rule)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// MongoRateLimitStore shares buckets between API instances. Each take is one
+// pipeline update, so concurrent requests can't both spend the last token.
+type MongoRateLimitStore struct {
+	Collection *mongo.Collection // rate_limits
+}
+
+// SetupRateLimitIndexes drops buckets once they'd be full again
+func SetupRateLimitIndexes(collection *mongo.Collection) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Println("Failed to create rate limit indexes:", err)
+	}
+}
+
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, rule RateLimitRule, now time.Time) (RateLimitResult, error) {
+	limit := float64(rule.Limit)
+	elapsed := bson.M{"$max": bson.A{0, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}},
+		1000,
+	}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{limit, bson.M{"$add": bson.A{
+				bson.M{"$ifNull": bson.A{"$tokens", limit}},
+				bson.M{"$multiply": bson.A{elapsed, rule.refillRate()}},
+			}}}},
+			"updatedAt": now,
+		}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":    bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expiresAt": now.Add(rule.Per),
+		}}},
+	}
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := s.Collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&bucket)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return bucketResult(bucket.Tokens, bucket.Allowed, rule), nil
+}
+
+// RateLimiter holds the per-route rules and the store their buckets live in
+type RateLimiter struct {
+	Rules map[string][]RateLimitRule
+	Store RateLimitStore
+}
+
+// NewRateLimiter loads the rules and picks the store from RATE_LIMIT_STORE:
+// "mongo" shares buckets through the rate_limits collection, anything else
+// keeps them in memory
+func NewRateLimiter(db *mongo.Database) *RateLimiter {
+	rules, err := LoadRateLimitRules()
+	if err != nil {
+		log.Println("Failed to load rate limit config, using defaults:", err)
+	}
+
+	var store RateLimitStore = NewMemoryRateLimitStore()
+	if strings.EqualFold(os.Getenv("RATE_LIMIT_STORE"), "mongo") {
+		collection := db.Collection("rate_limits")
+		SetupRateLimitIndexes(collection)
+		store = &MongoRateLimitStore{Collection: collection}
+	}
+
+	return &RateLimiter{Rules: rules, Store: store}
+}
+
+// Take spends a token from the bucket a rule gives this subject on the route
+func (l *RateLimiter) Take(ctx context.Context, route string, rule RateLimitRule, subject string) (RateLimitResult, error) {
+	key := fmt.Sprintf("%s|%s|%d/%s|%s", route, rule.Key, rule.Limit, rule.Per, HashToken(subject))
+	return l.Store.Take(ctx, key, rule, time.Now())
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Key: RateLimitByIP, Limit: 3, Per: 3 * time.Second} // one token a second
+	ctx := context.Background()
+	start := time.Now()
+
+	take := func(after time.Duration) RateLimitResult {
+		t.Helper()
+		result, err := store.Take(ctx, "k", rule, start.Add(after))
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		return result
+	}
+
+	for i, wantRemaining := range []int{2, 1, 0} {
+		if result := take(0); !result.Allowed || result.Remaining != wantRemaining {
+			t.Fatalf("take %d = %+v, want allowed with %d remaining", i+1, result, wantRemaining)
+		}
+	}
+
+	result := take(0)
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("take on an empty bucket = %+v, want refused with RetryAfter 1s", result)
+	}
+
+	result = take(500 * time.Millisecond)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("take after half a token = %+v, want refused with RetryAfter 500ms", result)
+	}
+
+	if result = take(time.Second); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take after a token refilled = %+v, want allowed with 0 remaining", result)
+	}
+
+	// refilling stops at the limit
+	if result = take(time.Minute); !result.Allowed || result.Remaining != 2 || result.Reset != time.Second {
+		t.Fatalf("take after a long wait = %+v, want allowed with 2 remaining and Reset 1s", result)
+	}
+}
+
+func TestMemoryRateLimitStoreKeysAreSeparate(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Key: RateLimitByIP, Limit: 1, Per: time.Minute}
+	now := time.Now()
+
+	if result, _ := store.Take(context.Background(), "a", rule, now); !result.Allowed {
+		t.Fatal("first take for a was refused")
+	}
+	if result, _ := store.Take(context.Background(), "a", rule, now); result.Allowed {
+		t.Fatal("second take for a was allowed")
+	}
+	if result, _ := store.Take(context.Background(), "b", rule, now); !result.Allowed {
+		t.Fatal("a's bucket limited b")
+	}
+}
+
+func TestMemoryRateLimitStoreClockGoingBack(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	rule := RateLimitRule{Key: RateLimitByIP, Limit: 1, Per: time.Minute}
+	now := time.Now()
+
+	_, _ = store.Take(context.Background(), "k", rule, now)
+	if result, _ := store.Take(context.Background(), "k", rule, now.Add(-time.Hour)); result.Allowed {
+		t.Fatal("an earlier timestamp refilled the bucket")
+	}
+}
+
+func TestRateLimitRuleUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    RateLimitRule
+		wantErr bool
+	}{
+		{json: `{"key": "ip", "limit": 30, "per": "5m"}`, want: RateLimitRule{Key: RateLimitByIP, Limit: 30, Per: 5 * time.Minute}},
+		{json: `{"key": "identifier", "limit": 5, "per": "1h30m"}`, want: RateLimitRule{Key: RateLimitByIdentifier, Limit: 5, Per: 90 * time.Minute}},
+		{json: `{"key": "user", "limit": 1, "per": "10s"}`, want: RateLimitRule{Key: RateLimitByUser, Limit: 1, Per: 10 * time.Second}},
+		{json: `{"key": "email", "limit": 5, "per": "5m"}`, wantErr: true},
+		{json: `{"key": "ip", "limit": 5, "per": "5 minutes"}`, wantErr: true},
+		{json: `{"key": "ip", "limit": 5}`, wantErr: true},
+		{json: `{"key": "ip", "limit": 0, "per": "5m"}`, wantErr: true},
+		{json: `{"key": "ip", "limit": 5, "per": "-5m"}`, wantErr: true},
+		{json: `["ip", 5, "5m"]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var got RateLimitRule
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %+v, want an error", tt.json, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, %v, want %+v", tt.json, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadRateLimitRulesOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rate_limits.json")
+	config := `{"POST /sign-in": [{"key": "ip", "limit": 3, "per": "1m"}], "POST /check-eid": []}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RATE_LIMIT_CONFIG", path)
+
+	rules, err := LoadRateLimitRules()
+	if err != nil {
+		t.Fatalf("LoadRateLimitRules: %v", err)
+	}
+
+	want := RateLimitRule{Key: RateLimitByIP, Limit: 3, Per: time.Minute}
+	if got := rules["POST /sign-in"]; len(got) != 1 || got[0] != want {
+		t.Errorf("POST /sign-in = %+v, want only %+v", got, want)
+	}
+	if got := rules["POST /check-eid"]; len(got) != 0 {
+		t.Errorf("POST /check-eid = %+v, want no rules", got)
+	}
+	if got := rules["POST /get-code"]; len(got) != len(defaultRateLimits["POST /get-code"]) {
+		t.Errorf("POST /get-code = %+v, want the defaults", got)
+	}
+}
+
+func TestDefaultRateLimitsAreValid(t *testing.T) {
+	for route, rules := range defaultRateLimits {
+		if len(rules) == 0 {
+			t.Errorf("%s has no rules", route)
+		}
+		for _, rule := range rules {
+			switch rule.Key {
+			case RateLimitByIP, RateLimitByIdentifier, RateLimitByUser:
+			default:
+				t.Errorf("%s: unknown key %q", route, rule.Key)
+			}
+			if rule.Limit <= 0 || rule.Per <= 0 {
+				t.Errorf("%s: rule %+v never lets a request through", route, rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import "time"
+
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// RiskSignals are the facts gathered about a sign-in attempt
+type RiskSignals struct {
+	Country        string // "" when GeoIP has no answer
+	KnownCountry   bool
+	KnownDevice    bool
+	HasHistory     bool // false for the very first sign-in
+	SinceLastLogin time.Duration
+	RecentFailures int // failed attempts in the last hour
+}
+
+type RiskAssessment struct {
+	Score   int      `json:"score"`
+	Level   string   `json:"level"`
+	Reasons []string `json:"reasons"`
+}
+
+// ScoreSignIn turns the signals into a 0-100 score and a risk level
+func ScoreSignIn(s RiskSignals) RiskAssessment {
+	a := RiskAssessment{Reasons: []string{}}
+
+	add := func(points int, reason string) {
+		a.Score += points
+		a.Reasons = append(a.Reasons, reason)
+	}
+
+	if s.Country == "" {
+		add(10, "unknown_location")
+	} else if s.HasHistory && !s.KnownCountry {
+		add(30, "new_country")
+	}
+
+	if !s.KnownDevice {
+		add(25, "new_device")
+	}
+
+	if s.HasHistory {
+		switch {
+		case s.SinceLastLogin > 90*24*time.Hour:
+			add(15, "long_inactivity")
+		case s.SinceLastLogin > 30*24*time.Hour:
+			add(5, "inactivity")
+		}
+	}
+
+	switch {
+	case s.RecentFailures > 5:
+		add(40, "failure_velocity")
+	case s.RecentFailures >= 3:
+		add(25, "failure_velocity")
+	case s.RecentFailures > 0:
+		add(10, "recent_failures")
+	}
+
+	if a.Score > 100 {
+		a.Score = 100
+	}
+
+	switch {
+	case a.Score >= 50:
+		a.Level = RiskHigh
+	case a.Score >= 20:
+		a.Level = RiskMedium
+	default:
+		a.Level = RiskLow
+	}
+
+	return a
+}
@@ -8,8 +8,6 @@ import (
 	openapi "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
-// For Later
-
 func SendSMS(to string, code string) error {
 	client := twilio.NewRestClientWithParams(twilio.ClientParams{
 		Username: os.Getenv("TWILIO_SID"),
@@ -17,7 +15,7 @@ func SendSMS(to string, code string) error {
 	})
 
 	from := os.Getenv("TWILIO_PHONE_NUMBER")
-	body := fmt.Sprintf("Your egoty reset code is: %s", code)
+	body := fmt.Sprintf("Your egoty verification code is: %s", code)
 
 	params := &openapi.CreateMessageParams{}
 	params.SetTo(to)
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignedToken = errors.New("invalid or expired token")
+
+// SignToken builds a "<payload>.<expiry>.<signature>" token. The purpose is
+// mixed into the HMAC so a token issued for one flow can't be replayed in another.
+func SignToken(purpose, payload string, ttl time.Duration) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	exp := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	body := encoded + "." + exp
+	return body + "." + tokenSignature(purpose, body)
+}
+
+// VerifyToken checks the signature and expiry and returns the original payload
+func VerifyToken(purpose, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidSignedToken
+	}
+
+	body := parts[0] + "." + parts[1]
+	expected := tokenSignature(purpose, body)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return "", ErrInvalidSignedToken
+	}
+
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", ErrInvalidSignedToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidSignedToken
+	}
+
+	return string(payload), nil
+}
+
+// HashToken returns the hex SHA-256 of a token, used when a token must be stored server-side
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns n random bytes encoded as URL-safe base64
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func tokenSignature(purpose, body string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
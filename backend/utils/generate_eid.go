@@ -8,10 +8,11 @@ import (
 	"time"
 )
 
-func GenerateEID() (string, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
+var eidClient = &http.Client{Timeout: 5 * time.Second}
 
-	resp, err := client.Get("http://64.227.167.28:9000/api/v1/neweid")
+// FetchEID asks the upstream EID service at url for a new EID
+func FetchEID(url string) (string, error) {
+	resp, err := eidClient.Get(url)
 	if err != nil {
 		fmt.Println("HTTP request error:", err)
 		return "", err
@@ -32,8 +33,6 @@ func GenerateEID() (string, error) {
 		return "", err
 	}
 
-	fmt.Println("Generated EID from API:", result.NewEID)
-
 	if len(result.NewEID) != 10 {
 		fmt.Println("Invalid EID length:", len(result.NewEID))
 		return "", errors.New("invalid EID returned from API")